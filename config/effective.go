@@ -0,0 +1,48 @@
+package config
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// DefaultRedactedKeys is used by LogEffective if no redacted keys are passed
+var DefaultRedactedKeys = []string{"password", "passwd", "secret", "token", "credential", "dsn"}
+
+const redacted = "[REDACTED]"
+
+// LogEffective logs all settings resolved by viper (flags, env and defaults) with their effective value.
+// The value of every key containing one of the redactedKeys (case-insensitive) is replaced.
+// If no redactedKeys are given, DefaultRedactedKeys are used.
+func LogEffective(logger *zap.Logger, redactedKeys ...string) {
+	if len(redactedKeys) == 0 {
+		redactedKeys = DefaultRedactedKeys
+	}
+
+	keys := viper.AllKeys()
+	sort.Strings(keys)
+
+	fields := make([]zap.Field, 0, len(keys))
+	for _, key := range keys {
+		if isRedacted(key, redactedKeys) {
+			fields = append(fields, zap.String(key, redacted))
+			continue
+		}
+		fields = append(fields, zap.Any(key, viper.Get(key)))
+	}
+
+	logger.Info("effective configuration", fields...)
+}
+
+// isRedacted checks whether the key contains any of the redacted keys
+func isRedacted(key string, redactedKeys []string) bool {
+	key = strings.ToLower(key)
+	for _, r := range redactedKeys {
+		if strings.Contains(key, strings.ToLower(r)) {
+			return true
+		}
+	}
+	return false
+}
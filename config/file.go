@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// OptionalPrefix marks a path passed to LoadAndMerge as optional, e.g. "?config.local.yaml"
+const OptionalPrefix = "?"
+
+// LoadAndMerge reads the config files in order and merges them into viper, so that later files
+// override the keys of earlier ones, e.g. a base config, an environment overlay and a secrets file.
+// The config type is derived from the file extension. Flags and environment variables still take
+// precedence over all files. Paths prefixed with OptionalPrefix are skipped if the file does not exist.
+func LoadAndMerge(paths ...string) error {
+	for _, path := range paths {
+		optional := strings.HasPrefix(path, OptionalPrefix)
+		path = strings.TrimPrefix(path, OptionalPrefix)
+
+		if _, err := os.Stat(path); err != nil {
+			if optional && os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+
+		viper.SetConfigFile(path)
+		if err := viper.MergeInConfig(); err != nil {
+			return fmt.Errorf("failed to merge config file %s: %w", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "mysql_query_duration_seconds",
+	Help:    "Duration of MySQL queries in seconds",
+	Buckets: prometheus.DefBuckets,
+}, []string{"operation"})
+
+var registerMetricsOnce sync.Once
+
+// registerMetrics registers the query duration histogram once, even if multiple MySQL instances exist.
+// New calls it before the instance runs any query, so observe never races with replacing the histogram.
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		if err := prometheus.Register(queryDuration); err != nil {
+			if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				queryDuration = are.ExistingCollector.(*prometheus.HistogramVec)
+			}
+		}
+	})
+}
+
+// NamedExecContext executes the named query using sqlx.
+// The query is instrumented with the duration metric and the slow-query log.
+func (m MySQL) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	defer m.observe("named_exec", query, time.Now())
+	return m.db.NamedExecContext(ctx, query, arg)
+}
+
+// NamedQueryContext runs the named query using sqlx.
+// The query is instrumented with the duration metric and the slow-query log.
+func (m MySQL) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
+	defer m.observe("named_query", query, time.Now())
+	return m.db.NamedQueryContext(ctx, query, arg)
+}
+
+// observe records the duration of the query and logs it if it exceeds the slow-query threshold
+func (m MySQL) observe(operation, query string, start time.Time) {
+	duration := time.Since(start)
+	queryDuration.WithLabelValues(operation).Observe(duration.Seconds())
+
+	if m.opts.SlowQueryThreshold > 0 && duration > m.opts.SlowQueryThreshold {
+		m.opts.Logger.Warn("slow query",
+			zap.String("operation", operation),
+			zap.String("query", query),
+			zap.Duration("duration", duration),
+			zap.Duration("threshold", m.opts.SlowQueryThreshold))
+	}
+}
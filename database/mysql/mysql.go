@@ -1,17 +1,24 @@
 package mysql
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"fmt"
-	"strings"
+	"io/ioutil"
+	"sync"
 	"time"
 
+	"github.com/golang-migrate/migrate/database"
 	"github.com/golang-migrate/migrate/database/mysql"
 
-	_ "github.com/go-sql-driver/mysql"
+	gomysql "github.com/go-sql-driver/mysql"
 	"github.com/golang-migrate/migrate"
 	_ "github.com/golang-migrate/migrate/source/file"
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
 )
 
 type MySQL struct {
@@ -26,6 +33,7 @@ const (
 	DefaultMaxIdleConnections    = 0
 	DefaultMaxConnectionLifetime = 600 * time.Second
 	DriverName                   = "mysql"
+	DefaultTLSConfigName         = "enki"
 )
 
 // New will connect to the MySQL server using the given DSN
@@ -35,12 +43,21 @@ func New(dsn string, options ...Option) (*MySQL, error) {
 		MaxOpenConnections:    DefaultMaxOpenConnections,
 		MaxIdleConnections:    DefaultMaxIdleConnections,
 		MaxConnectionLifetime: DefaultMaxConnectionLifetime,
+		Logger:                zap.NewNop(),
+		MigrationLockTimeout:  migrate.DefaultLockTimeout,
 	}
 
 	for _, opt := range options {
 		opt(args)
 	}
 
+	registerMetrics()
+
+	dsn, err := configureTLS(dsn, args)
+	if err != nil {
+		return nil, err
+	}
+
 	db, err := sqlx.Connect(DriverName, dsn)
 	if err != nil {
 		return nil, err
@@ -58,33 +75,161 @@ func New(dsn string, options ...Option) (*MySQL, error) {
 	}, nil
 }
 
+// configureTLS registers the TLS config with the driver and returns the DSN which references it.
+// If no TLS option is set, the DSN is returned unchanged.
+func configureTLS(dsn string, opts *Options) (string, error) {
+	config := opts.TLSConfig
+	if config == nil {
+		if opts.TLSCAFile == "" && opts.TLSServerName == "" && !opts.TLSSkipVerify {
+			return dsn, nil
+		}
+		config = &tls.Config{
+			ServerName:         opts.TLSServerName,
+			InsecureSkipVerify: opts.TLSSkipVerify,
+		}
+		if opts.TLSCAFile != "" {
+			pem, err := ioutil.ReadFile(opts.TLSCAFile)
+			if err != nil {
+				return "", errors.Wrap(err, "unable to read mysql CA file")
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return "", fmt.Errorf("no certificates found in mysql CA file %s", opts.TLSCAFile)
+			}
+			config.RootCAs = pool
+		}
+	}
+
+	name, err := registerTLSConfig(opts.TLSConfigName, config)
+	if err != nil {
+		return "", err
+	}
+
+	cfg, err := gomysql.ParseDSN(dsn)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to parse mysql DSN")
+	}
+	cfg.TLSConfig = name
+	return cfg.FormatDSN(), nil
+}
+
+var (
+	tlsConfigs      = make(map[string]*tls.Config)
+	tlsConfigCount  int
+	tlsConfigsMutex sync.Mutex
+)
+
+// registerTLSConfig registers the config with the driver, whose TLS configs are shared by the whole process.
+// Without a name, every instance gets its own name derived from DefaultTLSConfigName, so that instances with
+// different certificates do not overwrite each other. An explicit name cannot be reused for a different config.
+func registerTLSConfig(name string, config *tls.Config) (string, error) {
+	tlsConfigsMutex.Lock()
+	defer tlsConfigsMutex.Unlock()
+
+	for name == "" {
+		tlsConfigCount++
+		candidate := fmt.Sprintf("%s-%d", DefaultTLSConfigName, tlsConfigCount)
+		if _, ok := tlsConfigs[candidate]; !ok {
+			name = candidate
+		}
+	}
+	if registered, ok := tlsConfigs[name]; ok {
+		if registered != config {
+			return "", fmt.Errorf("a different mysql TLS config is already registered as %s", name)
+		}
+		return name, nil
+	}
+	if err := gomysql.RegisterTLSConfig(name, config); err != nil {
+		return "", errors.Wrap(err, "unable to register mysql TLS config")
+	}
+	tlsConfigs[name] = config
+	return name, nil
+}
+
+// MigrateResult describes the outcome of Migrate
+type MigrateResult struct {
+	// Changed is false if the schema already was at the requested version
+	Changed bool
+	// PreviousVersion is the schema version before migrating, 0 if no migration had been applied
+	PreviousVersion uint
+	// Version is the schema version after migrating
+	Version uint
+}
+
 // Migrate to a specific version. The migrations need to be placed in the MigrationPath.
 // For every change, two migrations should be created:
 // 		1_add_example_table.up.sql
 // 		1_add_example_table.down.sql
-func (m MySQL) Migrate(version uint) error {
+// The result reports whether any migration has been applied.
+func (m MySQL) Migrate(version uint) (MigrateResult, error) {
+	result := MigrateResult{}
+
 	db, err := sql.Open(DriverName, m.dsn)
 	if err != nil {
-		return err
+		return result, err
 	}
-	driver, err := mysql.WithInstance(db, &mysql.Config{})
-	migrations, err := migrate.NewWithDatabaseInstance(
-		fmt.Sprintf("file://%s", m.opts.MigrationPath),
-		DriverName,
-		driver)
+	driver, err := mysql.WithInstance(db, &mysql.Config{MigrationsTable: m.opts.MigrationsTable})
 	if err != nil {
-		return err
+		return result, err
 	}
+	migrations, err := m.newMigrate(driver)
+	if err != nil {
+		return result, err
+	}
+	migrations.LockTimeout = m.opts.MigrationLockTimeout
 
-	err = migrations.Migrate(version)
+	result.PreviousVersion, _, err = migrations.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return result, err
+	}
+
+	err = m.migrateLocked(migrations, version)
 	if err != nil {
-		if strings.Contains(err.Error(), "no change") {
-			return nil
+		if errors.Is(err, migrate.ErrNoChange) {
+			result.Version = result.PreviousVersion
+			return result, nil
+		}
+		if errors.Is(err, migrate.ErrLockTimeout) || errors.Is(err, database.ErrLocked) {
+			return result, fmt.Errorf("could not acquire migration lock within %s: %w", m.opts.MigrationLockTimeout, err)
+		}
+		return result, err
+	}
+
+	result.Changed = true
+	result.Version = version
+	return result, nil
+}
+
+// migrateLocked runs the migration and retries while the migration lock is held by another instance.
+// The MySQL driver gives up on the lock after 10 seconds with database.ErrLocked, independent of the
+// LockTimeout of migrate, so the attempts are repeated until the MigrationLockTimeout has elapsed.
+func (m MySQL) migrateLocked(migrations *migrate.Migrate, version uint) error {
+	deadline := time.Now().Add(m.opts.MigrationLockTimeout)
+	for {
+		err := migrations.Migrate(version)
+		if !errors.Is(err, database.ErrLocked) {
+			return err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return err
 		}
-		return err
+		migrations.LockTimeout = remaining
 	}
+}
 
-	return nil
+// newMigrate creates the migrate instance using the configured migration source.
+// A pre-built source driver is preferred over a source URL, which is preferred over the MigrationPath.
+func (m MySQL) newMigrate(driver database.Driver) (*migrate.Migrate, error) {
+	if m.opts.MigrationSource != nil {
+		return migrate.NewWithInstance("custom", m.opts.MigrationSource, DriverName, driver)
+	}
+
+	sourceURL := m.opts.MigrationSourceURL
+	if sourceURL == "" {
+		sourceURL = fmt.Sprintf("file://%s", m.opts.MigrationPath)
+	}
+	return migrate.NewWithDatabaseInstance(sourceURL, DriverName, driver)
 }
 
 // Close is just a proxy for convenient access to db.Close()
@@ -92,6 +237,29 @@ func (m MySQL) Close() error {
 	return m.db.Close()
 }
 
+// closePollInterval is the interval in which CloseContext checks for connections in use
+const closePollInterval = 50 * time.Millisecond
+
+// CloseContext waits until all connections have been returned to the pool, then closes it.
+// Queries which are still running can finish instead of failing with 'database is closed'.
+// If the context is done first, the pool is closed anyway and the context error is returned.
+// CloseContext should be called after the servers and consumers have stopped, e.g. in the
+// lifecycle.PhaseStorage of the shutdown coordinator, otherwise new queries keep the pool busy.
+func (m MySQL) CloseContext(ctx context.Context) error {
+	ticker := time.NewTicker(closePollInterval)
+	defer ticker.Stop()
+
+	for m.db.Stats().InUse > 0 {
+		select {
+		case <-ctx.Done():
+			_ = m.db.Close()
+			return fmt.Errorf("closed mysql pool with %d connections in use: %w", m.db.Stats().InUse, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return m.db.Close()
+}
+
 // DB is just a proxy for convenient access to the underlying sqlx implementation
 // This method is used a lot, therefore it's name is abbreviated.
 func (m MySQL) DB() *sqlx.DB {
@@ -1,14 +1,29 @@
 package mysql
 
 import (
+	"crypto/tls"
 	"time"
+
+	"github.com/golang-migrate/migrate/source"
+	"go.uber.org/zap"
 )
 
 type Options struct {
 	MigrationPath         string
+	MigrationSourceURL    string
+	MigrationSource       source.Driver
 	MaxOpenConnections    int
 	MaxIdleConnections    int
 	MaxConnectionLifetime time.Duration
+	TLSConfigName         string
+	TLSConfig             *tls.Config
+	TLSCAFile             string
+	TLSServerName         string
+	TLSSkipVerify         bool
+	Logger                *zap.Logger
+	SlowQueryThreshold    time.Duration
+	MigrationLockTimeout  time.Duration
+	MigrationsTable       string
 }
 
 type Option func(*Options)
@@ -19,6 +34,22 @@ func MigrationPath(path string) Option {
 	}
 }
 
+// MigrationSourceURL sets the golang-migrate source URL (e.g. s3://bucket/path) the migrations are read from.
+// The source driver needs to be imported by the caller. If set, MigrationPath is ignored.
+func MigrationSourceURL(url string) Option {
+	return func(options *Options) {
+		options.MigrationSourceURL = url
+	}
+}
+
+// MigrationSource sets a pre-built golang-migrate source driver the migrations are read from.
+// It takes precedence over MigrationSourceURL and MigrationPath.
+func MigrationSource(driver source.Driver) Option {
+	return func(options *Options) {
+		options.MigrationSource = driver
+	}
+}
+
 func MaxOpenConnections(connLimit int) Option {
 	return func(options *Options) {
 		options.MaxOpenConnections = connLimit
@@ -35,4 +66,66 @@ func MaxConnectionLifetime(maxLifetime time.Duration) Option {
 	return func(options *Options) {
 		options.MaxConnectionLifetime = maxLifetime
 	}
-}
\ No newline at end of file
+}
+
+// TLSConfig registers the given tls.Config with the driver under the name and enables it in the DSN.
+// An empty name registers it under a name of its own, a name cannot be reused for a different tls.Config.
+func TLSConfig(name string, config *tls.Config) Option {
+	return func(options *Options) {
+		options.TLSConfigName = name
+		options.TLSConfig = config
+	}
+}
+
+// TLSCAFile enables TLS and verifies the server certificate against the CA certificates in the PEM file.
+func TLSCAFile(path string) Option {
+	return func(options *Options) {
+		options.TLSCAFile = path
+	}
+}
+
+// TLSServerName enables TLS and sets the server name which is used to verify the server certificate.
+func TLSServerName(serverName string) Option {
+	return func(options *Options) {
+		options.TLSServerName = serverName
+	}
+}
+
+// TLSSkipVerify enables TLS but skips the verification of the server certificate.
+// This must only be used for development setups with self-signed certificates.
+func TLSSkipVerify() Option {
+	return func(options *Options) {
+		options.TLSSkipVerify = true
+	}
+}
+
+// Logger sets the logger which is used for the slow-query log, it defaults to a no-op logger.
+func Logger(logger *zap.Logger) Option {
+	return func(options *Options) {
+		options.Logger = logger
+	}
+}
+
+// SlowQueryThreshold sets the duration after which a query is logged as slow query, 0 disables the log.
+func SlowQueryThreshold(threshold time.Duration) Option {
+	return func(options *Options) {
+		options.SlowQueryThreshold = threshold
+	}
+}
+
+// MigrationLockTimeout sets how long Migrate waits for the migration lock, which is held while
+// another instance is migrating. It defaults to the golang-migrate DefaultLockTimeout.
+// The MySQL driver waits for the lock in attempts of 10 seconds, so the timeout is rounded up to them.
+func MigrationLockTimeout(timeout time.Duration) Option {
+	return func(options *Options) {
+		options.MigrationLockTimeout = timeout
+	}
+}
+
+// MigrationsTable sets the table in which the applied migration version is recorded.
+// Services sharing a database need distinct tables, it defaults to the golang-migrate 'schema_migrations'.
+func MigrationsTable(table string) Option {
+	return func(options *Options) {
+		options.MigrationsTable = table
+	}
+}
@@ -0,0 +1,54 @@
+package health
+
+import (
+	"time"
+)
+
+// Defaults of the readiness checks
+const (
+	DefaultCheckInterval = 5 * time.Second
+	DefaultCheckTimeout  = 2 * time.Second
+)
+
+// Options configure how the readiness checks are run and how failures during the startup are judged
+type Options struct {
+	// StartupGrace is the time in which failing checks mean "still warming up", 0 disables the grace
+	StartupGrace time.Duration
+	// ExitAfterGrace terminates the process if the checks did not pass once within the startup grace
+	ExitAfterGrace bool
+	CheckInterval  time.Duration
+	CheckTimeout   time.Duration
+}
+
+type Option func(*Options)
+
+// StartupGrace allows the readiness checks to fail for the given duration after the start.
+// During the grace the service reports not-ready but live. If the checks did not pass once
+// when the grace has elapsed, the service is considered broken and reports not-live.
+func StartupGrace(grace time.Duration) Option {
+	return func(options *Options) {
+		options.StartupGrace = grace
+	}
+}
+
+// ExitAfterGrace terminates the process if the service is broken after the startup grace,
+// instead of waiting for the orchestrator to act on the failing liveness endpoint
+func ExitAfterGrace() Option {
+	return func(options *Options) {
+		options.ExitAfterGrace = true
+	}
+}
+
+// CheckInterval sets the interval in which the readiness checks are run
+func CheckInterval(interval time.Duration) Option {
+	return func(options *Options) {
+		options.CheckInterval = interval
+	}
+}
+
+// CheckTimeout bounds the time a single run of all readiness checks may take
+func CheckTimeout(timeout time.Duration) Option {
+	return func(options *Options) {
+		options.CheckTimeout = timeout
+	}
+}
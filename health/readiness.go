@@ -0,0 +1,176 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Check reports whether a dependency of the service is usable, e.g. by pinging the database
+type Check func(ctx context.Context) error
+
+// State of the service as judged by the readiness checks
+type State int
+
+const (
+	// StateStarting means the checks did not pass yet, but the startup grace has not elapsed
+	StateStarting State = iota
+	// StateReady means all checks passed in the last run
+	StateReady
+	// StateNotReady means a check failed in the last run after the service had been ready before
+	StateNotReady
+	// StateBroken means the checks did not pass once within the startup grace
+	StateBroken
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "STARTING"
+	case StateReady:
+		return "READY"
+	case StateNotReady:
+		return "NOT READY"
+	default:
+		return "BROKEN"
+	}
+}
+
+// Readiness runs the registered checks periodically and distinguishes a service which is still
+// warming up from a service which is genuinely broken. Checks must be registered before Run is called.
+//
+//	readiness := health.NewReadiness(logger, health.StartupGrace(2*time.Minute))
+//	readiness.Register("mysql", func(ctx context.Context) error { return db.PingContext(ctx) })
+//	go readiness.Run(ctx, wg)
+//	mux.Handle("/ready", readiness.Ready())
+//	mux.Handle("/live", readiness.Live())
+type Readiness struct {
+	logger  *zap.Logger
+	opts    *Options
+	checks  map[string]Check
+	started time.Time
+	mutex   sync.Mutex
+	state   State
+	failed  []string
+}
+
+// NewReadiness returns a Readiness without any checks, the startup grace begins with the call
+func NewReadiness(logger *zap.Logger, options ...Option) *Readiness {
+	args := &Options{
+		CheckInterval: DefaultCheckInterval,
+		CheckTimeout:  DefaultCheckTimeout,
+	}
+
+	for _, opt := range options {
+		opt(args)
+	}
+
+	return &Readiness{
+		logger:  logger.Named("readiness"),
+		opts:    args,
+		checks:  make(map[string]Check),
+		started: time.Now(),
+		state:   StateStarting,
+	}
+}
+
+// Register adds a named check
+func (r *Readiness) Register(name string, check Check) {
+	r.checks[name] = check
+}
+
+// Run executes the checks immediately and then in the configured interval until the context is cancelled
+func (r *Readiness) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(r.opts.CheckInterval)
+	defer ticker.Stop()
+	for {
+		r.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// State returns the state after the last run of the checks
+func (r *Readiness) State() State {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.state
+}
+
+// Ready returns a http.HandlerFunc which responds with 200 if the service is ready and 503 otherwise
+func (r *Readiness) Ready() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.mutex.Lock()
+		state, failed := r.state, r.failed
+		r.mutex.Unlock()
+
+		if state != StateReady {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintf(w, "%s %s", state, strings.Join(failed, ","))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(state.String()))
+	}
+}
+
+// Live returns a http.HandlerFunc which responds with 503 only if the service is broken,
+// a service which is still starting or temporarily not ready is live.
+func (r *Readiness) Live() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		state := r.State()
+		if state == StateBroken {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		_, _ = w.Write([]byte(state.String()))
+	}
+}
+
+// check runs all checks and updates the state
+func (r *Readiness) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.CheckTimeout)
+	defer cancel()
+
+	var failed []string
+	for name, check := range r.checks {
+		if err := check(ctx); err != nil {
+			r.logger.Warn("readiness check failed", zap.String("check", name), zap.Error(err))
+			failed = append(failed, name)
+		}
+	}
+	sort.Strings(failed)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failed = failed
+
+	switch {
+	case len(failed) == 0:
+		r.state = StateReady
+	case r.state == StateReady || r.state == StateNotReady:
+		r.state = StateNotReady
+	case time.Since(r.started) < r.opts.StartupGrace:
+		r.state = StateStarting
+	default:
+		r.state = StateBroken
+		if r.opts.ExitAfterGrace {
+			r.logger.Fatal("readiness checks did not pass within the startup grace",
+				zap.Duration("grace", r.opts.StartupGrace),
+				zap.Strings("failed", failed))
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultTTL is how long the MemoryStore remembers a key if no TTL is given
+const DefaultTTL = 24 * time.Hour
+
+// Store records idempotency keys of processed requests and messages.
+// Implementations must be safe for concurrent use, a shared store (e.g. Redis using SET NX with expiry)
+// is required to deduplicate across multiple instances of a service.
+type Store interface {
+	// Seen records the key and reports whether it had already been recorded and did not expire yet.
+	// Recording and checking must be atomic, so that only one caller sees false for a key.
+	Seen(ctx context.Context, key string) (bool, error)
+	// Forget removes the key, so that a failed request or message can be processed again
+	Forget(ctx context.Context, key string) error
+}
+
+// MemoryStore is a Store which keeps the keys in memory until their TTL expired.
+// It only deduplicates within a single process.
+type MemoryStore struct {
+	ttl       time.Duration
+	mutex     sync.Mutex
+	keys      map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryStore returns an in-memory Store, keys expire after the ttl
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &MemoryStore{
+		ttl:       ttl,
+		keys:      make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// Seen implements Store
+func (m *MemoryStore) Seen(_ context.Context, key string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+	if expiry, ok := m.keys[key]; ok && now.Before(expiry) {
+		return true, nil
+	}
+	m.keys[key] = now.Add(m.ttl)
+	return false, nil
+}
+
+// Forget implements Store
+func (m *MemoryStore) Forget(_ context.Context, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.keys, key)
+	return nil
+}
+
+// sweep removes expired keys, at most once per TTL to keep Seen cheap
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < m.ttl {
+		return
+	}
+	for key, expiry := range m.keys {
+		if !now.Before(expiry) {
+			delete(m.keys, key)
+		}
+	}
+	m.lastSweep = now
+}
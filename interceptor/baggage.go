@@ -0,0 +1,53 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/lukasjarosch/enki/trace"
+)
+
+// Baggage reads the baggage items of the incoming metadata into the context, see trace.BaggageItem
+func Baggage() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			ctx = trace.ExtractBaggage(ctx, metadataCarrier(md))
+		}
+		return handler(ctx, req)
+	}
+}
+
+// BaggageClient writes the baggage items of the context into the outgoing metadata
+func BaggageClient() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if items := trace.BaggageItems(ctx); len(items) > 0 {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			md = md.Copy()
+			trace.InjectBaggage(ctx, metadataCarrier(md))
+			ctx = metadata.NewOutgoingContext(ctx, md)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// metadataCarrier implements the opentracing TextMap carrier for gRPC metadata
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Set(key, value string) {
+	key = strings.ToLower(key)
+	c[key] = append(c[key], value)
+}
+
+func (c metadataCarrier) ForeachKey(handler func(key, value string) error) error {
+	for key, values := range c {
+		for _, value := range values {
+			if err := handler(key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
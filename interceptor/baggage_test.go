@@ -0,0 +1,102 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/lukasjarosch/enki/trace"
+)
+
+func TestMetadataCarrierRoundTrip(t *testing.T) {
+	ctx := trace.SetBaggageItem(context.Background(), "tenant", "acme")
+	ctx = trace.SetBaggageItem(ctx, "User-Id", "42")
+
+	md := metadata.MD{}
+	trace.InjectBaggage(ctx, metadataCarrier(md))
+
+	extracted := trace.ExtractBaggage(context.Background(), metadataCarrier(md))
+	if value := trace.BaggageItem(extracted, "tenant"); value != "acme" {
+		t.Errorf("expected baggage item tenant=acme, got %q", value)
+	}
+	// gRPC metadata keys are lower case, so are the extracted baggage keys
+	if value := trace.BaggageItem(extracted, "user-id"); value != "42" {
+		t.Errorf("expected baggage item user-id=42, got %q", value)
+	}
+}
+
+// hopServer is a health server which forwards each check to the next hop, if any,
+// and records the baggage item it observed.
+type hopServer struct {
+	next     grpc_health_v1.HealthClient
+	observed chan string
+}
+
+func (s *hopServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	s.observed <- trace.BaggageItem(ctx, "tenant")
+	if s.next != nil {
+		return s.next.Check(ctx, req)
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *hopServer) Watch(*grpc_health_v1.HealthCheckRequest, grpc_health_v1.Health_WatchServer) error {
+	return nil
+}
+
+// startHop serves srv over an in-memory listener and returns a client connected to it,
+// the returned func stops the server and closes the client connection
+func startHop(t *testing.T, srv grpc_health_v1.HealthServer) (grpc_health_v1.HealthClient, func()) {
+	t.Helper()
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.UnaryInterceptor(Baggage()))
+	grpc_health_v1.RegisterHealthServer(server, srv)
+	go server.Serve(listener)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(BaggageClient()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+	)
+	if err != nil {
+		server.Stop()
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+
+	return grpc_health_v1.NewHealthClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func TestBaggagePropagatesAcrossHops(t *testing.T) {
+	const hops = 3
+
+	servers := make([]*hopServer, hops)
+	var next grpc_health_v1.HealthClient
+	for i := hops - 1; i >= 0; i-- {
+		servers[i] = &hopServer{next: next, observed: make(chan string, 1)}
+		client, stop := startHop(t, servers[i])
+		defer stop()
+		next = client
+	}
+
+	ctx := trace.SetBaggageItem(context.Background(), "tenant", "acme")
+	if _, err := next.Check(ctx, &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+
+	for i, server := range servers {
+		if value := <-server.observed; value != "acme" {
+			t.Errorf("hop %d: expected baggage item tenant=acme, got %q", i, value)
+		}
+	}
+}
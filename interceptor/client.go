@@ -0,0 +1,55 @@
+package interceptor
+
+import (
+	"context"
+
+	grpcopentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
+	grpcprometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	enkimetadata "github.com/lukasjarosch/enki/metadata"
+)
+
+// DefaultClientChain returns the standard client-side interceptors: request-id and baggage propagation, tracing and prometheus.
+// Additional interceptors are appended to the chain. The result can be passed to grpc.WithChainUnaryInterceptor:
+//
+//	grpc.Dial(addr, grpc.WithChainUnaryInterceptor(interceptor.DefaultClientChain()...))
+func DefaultClientChain(interceptors ...grpc.UnaryClientInterceptor) []grpc.UnaryClientInterceptor {
+	chain := []grpc.UnaryClientInterceptor{
+		RequestIdClient(),
+		BaggageClient(),
+		grpcopentracing.UnaryClientInterceptor(),
+		grpcprometheus.UnaryClientInterceptor,
+	}
+	return append(chain, interceptors...)
+}
+
+// RequestIdClient forwards the request-id of the incoming request to the outgoing call, using the same
+// metadata key as the RequestId server interceptor. A request-id which is already set in the outgoing metadata
+// is kept. If the context carries no request-id, e.g. in a background job, a new one is generated.
+func RequestIdClient() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(enkimetadata.RequestID)) > 0 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		requestID := incomingRequestID(ctx)
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, enkimetadata.RequestID, requestID)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// incomingRequestID returns the request-id from the incoming metadata or the context value of the RequestId interceptor
+func incomingRequestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if requestID := md.Get(enkimetadata.RequestID); len(requestID) > 0 {
+			return requestID[0]
+		}
+	}
+	requestID, _ := enkimetadata.RequestIDFromContext(ctx)
+	return requestID
+}
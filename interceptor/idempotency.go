@@ -0,0 +1,40 @@
+package interceptor
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lukasjarosch/enki/idempotency"
+	enkimetadata "github.com/lukasjarosch/enki/metadata"
+)
+
+// Idempotency short-circuits calls whose idempotency key (metadata.IdempotencyKey) has already been
+// processed with codes.AlreadyExists. Calls without a key are always handled. If the handler fails,
+// the key is forgotten so that the client can retry the call with the same key.
+// Keys are scoped per method, the same key can be used for different methods.
+func Idempotency(store idempotency.Store) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		key := enkimetadata.GetIdempotencyKey(ctx)
+		if key == "" {
+			return handler(ctx, req)
+		}
+		key = info.FullMethod + ":" + key
+
+		seen, err := store.Seen(ctx, key)
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "failed to check idempotency key: %s", err)
+		}
+		if seen {
+			return nil, status.Errorf(codes.AlreadyExists, "request with idempotency key has already been processed")
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			_ = store.Forget(ctx, key)
+		}
+		return resp, err
+	}
+}
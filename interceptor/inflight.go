@@ -0,0 +1,20 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// InFlight tracks the number of currently running requests per method in the given gauge.
+// The gauge must have a single 'grpc_method' label.
+func InFlight(gauge *prometheus.GaugeVec) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		inFlight := gauge.WithLabelValues(info.FullMethod)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,131 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Defaults of the JWTAuth interceptor
+const (
+	DefaultJWTHeader = "authorization"
+	DefaultJWTPrefix = "Bearer "
+)
+
+// JWTOptions holds the optional settings of the JWTAuth interceptor
+type JWTOptions struct {
+	// Header is the metadata key which carries the token, it defaults to DefaultJWTHeader
+	Header string
+	// Prefix precedes the token in the header, it defaults to DefaultJWTPrefix and is matched case-insensitively
+	Prefix string
+	// NewClaims returns the claims into which tokens are parsed, it defaults to jwt.MapClaims
+	NewClaims func() jwt.Claims
+}
+
+type JWTOption func(*JWTOptions)
+
+// JWTHeader sets the metadata key which carries the token
+func JWTHeader(header string) JWTOption {
+	return func(options *JWTOptions) {
+		options.Header = strings.ToLower(header)
+	}
+}
+
+// JWTPrefix sets the prefix which precedes the token in the header, an empty prefix expects the bare token
+func JWTPrefix(prefix string) JWTOption {
+	return func(options *JWTOptions) {
+		options.Prefix = prefix
+	}
+}
+
+// JWTClaims sets the claims type into which tokens are parsed, e.g. a struct embedding jwt.StandardClaims
+func JWTClaims(newClaims func() jwt.Claims) JWTOption {
+	return func(options *JWTOptions) {
+		options.NewClaims = newClaims
+	}
+}
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the claims of the token which has been validated by JWTAuth
+func ClaimsFromContext(ctx context.Context) (jwt.Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(jwt.Claims)
+	return claims, ok
+}
+
+// StaticKey returns a jwt.Keyfunc which validates all tokens with the same key: a []byte for HMAC,
+// an *rsa.PublicKey for RSA or an *ecdsa.PublicKey for ECDSA signatures.
+// Tokens which are signed with an algorithm that does not match the key are rejected.
+func StaticKey(key interface{}) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		var ok bool
+		switch key.(type) {
+		case []byte:
+			_, ok = token.Method.(*jwt.SigningMethodHMAC)
+		case *rsa.PublicKey:
+			_, ok = token.Method.(*jwt.SigningMethodRSA)
+			if !ok {
+				_, ok = token.Method.(*jwt.SigningMethodRSAPSS)
+			}
+		case *ecdsa.PublicKey:
+			_, ok = token.Method.(*jwt.SigningMethodECDSA)
+		}
+		if !ok {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Header["alg"])
+		}
+		return key, nil
+	}
+}
+
+// JWTAuth validates the bearer token of every call using the key returned by keyFunc, see StaticKey.
+// The claims of a valid token are put into the context, handlers read them with ClaimsFromContext.
+// Calls without a valid token fail with codes.Unauthenticated. The exemptMethods, full method names
+// like '/grpc.health.v1.Health/Check', are passed through without authentication.
+func JWTAuth(keyFunc jwt.Keyfunc, exemptMethods []string, options ...JWTOption) grpc.UnaryServerInterceptor {
+	args := &JWTOptions{
+		Header: DefaultJWTHeader,
+		Prefix: DefaultJWTPrefix,
+		NewClaims: func() jwt.Claims {
+			return jwt.MapClaims{}
+		},
+	}
+
+	for _, opt := range options {
+		opt(args)
+	}
+
+	exempt := make(map[string]bool, len(exemptMethods))
+	for _, method := range exemptMethods {
+		exempt[method] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if exempt[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(args.Header)
+		if len(values) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "missing token")
+		}
+		raw := values[0]
+		if len(raw) < len(args.Prefix) || !strings.EqualFold(raw[:len(args.Prefix)], args.Prefix) {
+			return nil, status.Error(codes.Unauthenticated, "malformed token")
+		}
+
+		claims := args.NewClaims()
+		if _, err := jwt.ParseWithClaims(raw[len(args.Prefix):], claims, keyFunc); err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token: %s", err)
+		}
+		return handler(context.WithValue(ctx, claimsKey{}, claims), req)
+	}
+}
@@ -0,0 +1,33 @@
+package interceptor
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/lukasjarosch/enki/logging"
+)
+
+// Logger logs every call using the access-log schema of the logging package: the method, duration,
+// status code and request-id. Failed calls are logged on error level, all others on info level.
+// It must be placed after the RequestId interceptor, so that calls without request-id have one in the log.
+func Logger(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		code := status.Code(err)
+		fields := append(requestFields(ctx, info.FullMethod),
+			zap.String(logging.FieldStatus, code.String()),
+			logging.DurationMs(time.Since(start)))
+		if err != nil {
+			logger.Error("gRPC call failed", append(fields, zap.Error(err))...)
+			return resp, err
+		}
+		logger.Info("gRPC call handled", fields...)
+		return resp, err
+	}
+}
@@ -0,0 +1,98 @@
+package interceptor
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"github.com/lukasjarosch/enki/logging"
+)
+
+// DefaultPayloadLogSize is the amount of bytes logged per payload if no size is given
+const DefaultPayloadLogSize = 4096
+
+const redacted = "[REDACTED]"
+
+// PayloadLogging logs the request and response messages as JSON on debug level.
+// The interceptor does nothing unless the logger has debug level enabled, so it is safe to keep it in the chain.
+// Payloads are truncated to maxSize bytes (DefaultPayloadLogSize if maxSize <= 0). The values of all fields
+// which are named like any of the redactedFields (proto field names) are replaced, regardless of their nesting.
+func PayloadLogging(logger *zap.Logger, maxSize int, redactedFields ...string) grpc.UnaryServerInterceptor {
+	if maxSize <= 0 {
+		maxSize = DefaultPayloadLogSize
+	}
+	redact := make(map[string]bool)
+	for _, field := range redactedFields {
+		redact[field] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !logger.Core().Enabled(zap.DebugLevel) {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		logger.Debug("gRPC payload",
+			zap.String(logging.FieldFullMethod, info.FullMethod),
+			zap.String("grpc.request", marshalPayload(req, maxSize, redact)),
+			zap.String("grpc.response", marshalPayload(resp, maxSize, redact)),
+			logging.DurationMs(time.Since(start)),
+			zap.Error(err))
+
+		return resp, err
+	}
+}
+
+// marshalPayload returns the redacted and truncated JSON representation of the message
+func marshalPayload(payload interface{}, maxSize int, redact map[string]bool) string {
+	message, ok := payload.(proto.Message)
+	if !ok || message == nil {
+		return ""
+	}
+
+	marshaler := jsonpb.Marshaler{OrigName: true}
+	raw, err := marshaler.MarshalToString(message)
+	if err != nil {
+		return "<unable to marshal payload: " + err.Error() + ">"
+	}
+
+	if len(redact) > 0 {
+		var fields interface{}
+		if err := json.Unmarshal([]byte(raw), &fields); err == nil {
+			if redactedRaw, err := json.Marshal(redactFields(fields, redact)); err == nil {
+				raw = string(redactedRaw)
+			}
+		}
+	}
+
+	if len(raw) > maxSize {
+		return raw[:maxSize] + "...(truncated)"
+	}
+	return raw
+}
+
+// redactFields replaces the values of all object keys which are in redact
+func redactFields(value interface{}, redact map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redact[key] {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactFields(field, redact)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactFields(item, redact)
+		}
+	}
+	return value
+}
@@ -0,0 +1,58 @@
+package interceptor
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc/peer"
+)
+
+// peerIP extracts the IP address of the calling peer from the context.
+// If the context carries no peer or the peer is not an IP address, nil is returned.
+func peerIP(ctx context.Context) net.IP {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return nil
+	}
+
+	switch addr := p.Addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// isTrustedPeer checks whether the peer IP is contained in any of the trusted networks
+func isTrustedPeer(ctx context.Context, trusted []*net.IPNet) bool {
+	ip := peerIP(ctx)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCIDRs parses the CIDR notations (e.g. 10.0.0.0/8) into networks
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR '%s': %s", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
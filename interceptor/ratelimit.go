@@ -0,0 +1,73 @@
+package interceptor
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Limit is the rate (calls per second) and burst of a rate limiter, the zero Limit disables limiting
+type Limit struct {
+	Rate  rate.Limit
+	Burst int
+}
+
+// limiter returns the rate.Limiter of the limit, nil if the limit is the zero Limit
+func (l Limit) limiter() *rate.Limiter {
+	if l == (Limit{}) {
+		return nil
+	}
+	return rate.NewLimiter(l.Rate, l.Burst)
+}
+
+// RateLimit rejects calls with codes.ResourceExhausted if they exceed the global limit or the limit of their method.
+// The methods map full method names, e.g. '/package.Service/Method', to their limit. A call must pass both limiters,
+// methods without an entry are only subject to the global limit. A call rejected by the global limiter does not use up
+// the budget of its method. Calls are never queued, so clients should retry with backoff.
+func RateLimit(global Limit, methods map[string]Limit) grpc.UnaryServerInterceptor {
+	globalLimiter := global.limiter()
+	methodLimiters := make(map[string]*rate.Limiter, len(methods))
+	for method, limit := range methods {
+		if limiter := limit.limiter(); limiter != nil {
+			methodLimiters[method] = limiter
+		}
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		now := time.Now()
+		var method *rate.Reservation
+		if limiter, ok := methodLimiters[info.FullMethod]; ok {
+			if method, ok = reserve(limiter, now); !ok {
+				return nil, status.Errorf(codes.ResourceExhausted, "%s is rate limited, retry later", info.FullMethod)
+			}
+		}
+		if globalLimiter != nil {
+			if _, ok := reserve(globalLimiter, now); !ok {
+				// the call is not handled, so it must not use up the budget of its method
+				if method != nil {
+					method.CancelAt(now)
+				}
+				return nil, status.Error(codes.ResourceExhausted, "server is rate limited, retry later")
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// reserve takes a token of the limiter if one is available at now. The reservation gives the token back
+// if it is cancelled at the same now, a later cancellation does not restore tokens which were available immediately.
+func reserve(limiter *rate.Limiter, now time.Time) (*rate.Reservation, bool) {
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return nil, false
+	}
+	if reservation.DelayFrom(now) > 0 {
+		reservation.CancelAt(now)
+		return nil, false
+	}
+	return reservation, true
+}
@@ -0,0 +1,82 @@
+package interceptor
+
+import (
+	"context"
+
+	grpcrecovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/lukasjarosch/enki/logging"
+	enkimetadata "github.com/lukasjarosch/enki/metadata"
+	"github.com/lukasjarosch/enki/recovery"
+)
+
+// RecoveryMode defines what happens after a panic has been recovered and logged
+type RecoveryMode int
+
+const (
+	// RecoveryModeError converts the panic into a codes.Internal error, the process keeps running
+	RecoveryModeError RecoveryMode = iota
+	// RecoveryModePanic re-panics after logging, which will crash the process
+	RecoveryModePanic
+)
+
+// RecoveryHandler returns a handler for the grpcrecovery interceptors which logs
+// the panic value together with the stack trace. Depending on the mode, the panic is then
+// either converted into a codes.Internal error or re-raised.
+// The handler does not know the request, prefer Recovery which also logs the method and request-id.
+func RecoveryHandler(logger *zap.Logger, mode RecoveryMode) grpcrecovery.RecoveryHandlerFunc {
+	return func(p interface{}) error {
+		return recovered(logger, mode, p)
+	}
+}
+
+// Recovery recovers from panics in unary handlers, the panic is logged using recovery.Log
+// together with the method and request-id. Depending on the mode, the panic is then
+// either converted into a codes.Internal error or re-raised.
+func Recovery(logger *zap.Logger, mode RecoveryMode) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(logger, mode, p, requestFields(ctx, info.FullMethod)...)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecovery works like Recovery, but for streaming handlers
+func StreamRecovery(logger *zap.Logger, mode RecoveryMode) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(logger, mode, p, requestFields(stream.Context(), info.FullMethod)...)
+			}
+		}()
+		return handler(srv, stream)
+	}
+}
+
+// recovered logs the panic and either re-panics or returns a codes.Internal error
+func recovered(logger *zap.Logger, mode RecoveryMode, p interface{}, fields ...zap.Field) error {
+	recovery.Log(logger, p, recovery.TransportGRPC, fields...)
+	if mode == RecoveryModePanic {
+		panic(p)
+	}
+	return status.Errorf(codes.Internal, "%v", p)
+}
+
+// requestFields describes the call for the panic and access logs. The request-id is read from the incoming metadata,
+// it is not in the context yet if the panic occurred before the RequestId interceptor.
+func requestFields(ctx context.Context, fullMethod string) []zap.Field {
+	fields := []zap.Field{zap.String(logging.FieldFullMethod, fullMethod)}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ids := md.Get(enkimetadata.RequestID); len(ids) > 0 {
+		fields = append(fields, zap.String(logging.FieldRequestID, ids[0]))
+	}
+	return fields
+}
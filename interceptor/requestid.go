@@ -2,37 +2,79 @@ package interceptor
 
 import (
 	"context"
+	"net"
 
 	"github.com/google/uuid"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 
 	enkimetadata "github.com/lukasjarosch/enki/metadata"
 )
 
+// RequestId ensures that every request has a request-id. An incoming request-id is always honored.
 func RequestId() grpc.UnaryServerInterceptor {
+	return requestId(func(ctx context.Context) bool {
+		return true
+	})
+}
+
+// TrustedRequestId works like RequestId, but an incoming request-id is only honored if the peer address
+// is within one of the trusted networks. Requests from any other peer get a new request-id.
+func TrustedRequestId(trusted ...*net.IPNet) grpc.UnaryServerInterceptor {
+	return requestId(func(ctx context.Context) bool {
+		return isTrustedPeer(ctx, trusted)
+	})
+}
+
+// StreamRequestId works like RequestId, but for streaming calls
+func StreamRequestId() grpc.StreamServerInterceptor {
+	return streamRequestId(func(ctx context.Context) bool {
+		return true
+	})
+}
+
+// TrustedStreamRequestId works like TrustedRequestId, but for streaming calls
+func TrustedStreamRequestId(trusted ...*net.IPNet) grpc.StreamServerInterceptor {
+	return streamRequestId(func(ctx context.Context) bool {
+		return isTrustedPeer(ctx, trusted)
+	})
+}
+
+func requestId(trust func(ctx context.Context) bool) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		if md, ok := metadata.FromIncomingContext(ctx); ok {
-
-			requestID := md.Get(enkimetadata.RequestID)
-			if len(requestID) > 0 {
-				ctx = context.WithValue(ctx, enkimetadata.RequestID, requestID)
-				return handler(ctx, req)
-			}
-
-			newRequestID := newRequestID()
-			md.Append(enkimetadata.RequestID, newRequestID)
-			ctx = metadata.NewIncomingContext(ctx, md)
-			ctx = context.WithValue(ctx, enkimetadata.RequestID, newRequestID)
-			return handler(ctx, req)
+		return handler(withRequestId(ctx, trust), req)
+	}
+}
+
+func streamRequestId(trust func(ctx context.Context) bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = withRequestId(stream.Context(), trust)
+		return handler(srv, wrapped)
+	}
+}
+
+// withRequestId returns the context with the incoming request-id, if it is trusted, or a new one.
+// The request-id is stored in the incoming metadata and in the context, see enkimetadata.RequestIDFromContext.
+func withRequestId(ctx context.Context, trust func(ctx context.Context) bool) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+
+		requestID := md.Get(enkimetadata.RequestID)
+		if len(requestID) > 0 && trust(ctx) {
+			return enkimetadata.WithRequestID(ctx, requestID[0])
 		}
 
 		newRequestID := newRequestID()
-		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(enkimetadata.RequestID, newRequestID))
-		ctx = context.WithValue(ctx, enkimetadata.RequestID, newRequestID)
-		return handler(ctx, req)
+		md = md.Copy()
+		md.Set(enkimetadata.RequestID, newRequestID)
+		ctx = metadata.NewIncomingContext(ctx, md)
+		return enkimetadata.WithRequestID(ctx, newRequestID)
 	}
 
+	newRequestID := newRequestID()
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(enkimetadata.RequestID, newRequestID))
+	return enkimetadata.WithRequestID(ctx, newRequestID)
 }
 
 func newRequestID() string {
@@ -0,0 +1,45 @@
+package interceptor
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	enkimetadata "github.com/lukasjarosch/enki/metadata"
+)
+
+// RequireMetadata rejects calls with codes.InvalidArgument if any of the metadata keys is missing or empty.
+// The validated values are stored in the context and can be read using metadata.Required.
+func RequireMetadata(keys ...string) grpc.UnaryServerInterceptor {
+	return RequireMetadataExcept(nil, keys...)
+}
+
+// RequireMetadataExcept works like RequireMetadata, but calls to the exempt methods (full method names,
+// e.g. /grpc.health.v1.Health/Check) are passed to the handler without validation.
+func RequireMetadataExcept(exemptMethods []string, keys ...string) grpc.UnaryServerInterceptor {
+	exempt := make(map[string]bool)
+	for _, method := range exemptMethods {
+		exempt[method] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if exempt[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := make(map[string]string, len(keys))
+		for _, key := range keys {
+			vals := md.Get(key)
+			if len(vals) == 0 || vals[0] == "" {
+				return nil, status.Errorf(codes.InvalidArgument, "missing required metadata '%s'", key)
+			}
+			values[key] = vals[0]
+		}
+
+		return handler(enkimetadata.WithRequired(ctx, values), req)
+	}
+}
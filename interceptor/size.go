@@ -0,0 +1,29 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// MessageSizeBuckets are exponential buckets from 64B up to 4MiB, the default maximum gRPC message size
+var MessageSizeBuckets = prometheus.ExponentialBuckets(64, 4, 9)
+
+// MessageSize records the encoded size in bytes of requests and responses per method in the given histograms.
+// Both histograms must have a single 'grpc_method' label. Messages which are not a proto.Message are skipped,
+// as are responses of failed calls.
+func MessageSize(requestSize, responseSize *prometheus.HistogramVec) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if msg, ok := req.(proto.Message); ok {
+			requestSize.WithLabelValues(info.FullMethod).Observe(float64(proto.Size(msg)))
+		}
+
+		resp, err := handler(ctx, req)
+		if msg, ok := resp.(proto.Message); ok && err == nil {
+			responseSize.WithLabelValues(info.FullMethod).Observe(float64(proto.Size(msg)))
+		}
+		return resp, err
+	}
+}
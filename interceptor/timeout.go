@@ -0,0 +1,57 @@
+package interceptor
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lukasjarosch/enki/recovery"
+)
+
+// Timeout limits the duration of every call to the timeout, an earlier deadline of the client is respected.
+// If the handler does not return in time, the call fails with codes.DeadlineExceeded.
+//
+// The handler keeps running in the background until it returns, Timeout cannot stop it. Handlers must
+// honor the cancellation of their context, otherwise their goroutines still pile up under load.
+// A panic of the handler is re-raised in the calling goroutine as a *recovery.Panic, which keeps the
+// stack trace of the handler, so that the Recovery interceptor sees it.
+func Timeout(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		type result struct {
+			resp  interface{}
+			err   error
+			panic interface{}
+		}
+		done := make(chan result, 1)
+		go func() {
+			var r result
+			defer func() {
+				if p := recover(); p != nil {
+					r.panic = &recovery.Panic{Value: p, Stack: debug.Stack()}
+				}
+				done <- r
+			}()
+			r.resp, r.err = handler(ctx, req)
+		}()
+
+		select {
+		case r := <-done:
+			if r.panic != nil {
+				panic(r.panic)
+			}
+			return r.resp, r.err
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, status.Errorf(codes.DeadlineExceeded, "%s did not finish in time", info.FullMethod)
+			}
+			return nil, status.Error(codes.Canceled, ctx.Err().Error())
+		}
+	}
+}
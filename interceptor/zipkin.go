@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
 	"google.golang.org/grpc"
 )
 
@@ -13,8 +15,12 @@ func ZipkinInterceptor() grpc.UnaryServerInterceptor {
 		defer span.Finish()
 
 		defer func() {
+			if err == nil {
+				return
+			}
 			if span := opentracing.SpanFromContext(ctx); span != nil {
-				span.SetTag("error", err.Error())
+				ext.Error.Set(span, true)
+				span.LogFields(otlog.String("event", "error"), otlog.String("message", err.Error()))
 			}
 		}()
 
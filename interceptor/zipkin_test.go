@@ -0,0 +1,73 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"google.golang.org/grpc"
+)
+
+func invokeZipkin(t *testing.T, handlerErr error) *mocktracer.MockSpan {
+	t.Helper()
+
+	tracer := mocktracer.New()
+	previous := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(previous)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "response", handlerErr
+	}
+
+	_, err := ZipkinInterceptor()(context.Background(), "request", info, handler)
+	if err != handlerErr {
+		t.Fatalf("expected error %v, got %v", handlerErr, err)
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 finished span, got %d", len(spans))
+	}
+	return spans[0]
+}
+
+func TestZipkinInterceptorWithoutError(t *testing.T) {
+	span := invokeZipkin(t, nil)
+
+	if span.OperationName != "/test.Service/Method" {
+		t.Errorf("expected operation name %q, got %q", "/test.Service/Method", span.OperationName)
+	}
+	if tag := span.Tag("error"); tag != nil {
+		t.Errorf("expected no error tag, got %v", tag)
+	}
+	if logs := span.Logs(); len(logs) != 0 {
+		t.Errorf("expected no logs, got %d", len(logs))
+	}
+}
+
+func TestZipkinInterceptorWithError(t *testing.T) {
+	span := invokeZipkin(t, errors.New("handler failed"))
+
+	if tag := span.Tag("error"); tag != true {
+		t.Errorf("expected error tag to be true, got %v", tag)
+	}
+
+	logs := span.Logs()
+	if len(logs) != 1 {
+		t.Fatalf("expected 1 log record, got %d", len(logs))
+	}
+	fields := map[string]string{}
+	for _, field := range logs[0].Fields {
+		fields[field.Key] = field.ValueString
+	}
+	if fields["event"] != "error" {
+		t.Errorf("expected event field %q, got %q", "error", fields["event"])
+	}
+	if fields["message"] != "handler failed" {
+		t.Errorf("expected message field %q, got %q", "handler failed", fields["message"])
+	}
+}
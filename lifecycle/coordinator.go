@@ -0,0 +1,175 @@
+package lifecycle
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// Phase defines the position of a component in the shutdown sequence.
+// Phases are shut down in ascending order, a phase is only started once the previous phase has completed.
+type Phase int
+
+const (
+	// PhaseServers stops accepting new requests (gRPC, HTTP)
+	PhaseServers Phase = iota * 10
+	// PhaseConsumers drains the message consumers
+	PhaseConsumers
+	// PhaseStorage closes databases and other dependencies the handlers rely on
+	PhaseStorage
+)
+
+// ShutdownFunc is executed once the phase it was registered for is shut down.
+type ShutdownFunc func(ctx context.Context) error
+
+// Coordinator runs components and shuts them down in ordered phases, so that dependencies
+// are still available until all of their dependents have drained.
+//
+//	c := lifecycle.NewCoordinator(logger)
+//	c.Go(lifecycle.PhaseServers, "grpc", func(ctx context.Context) {
+//		wg := &sync.WaitGroup{}
+//		wg.Add(1)
+//		grpcServer.ListenAndServe(ctx, wg)
+//	})
+//	c.OnShutdown(lifecycle.PhaseConsumers, "amqp", func(ctx context.Context) error {
+//		session.Shutdown()
+//		return nil
+//	})
+//	c.OnShutdown(lifecycle.PhaseStorage, "mysql", func(ctx context.Context) error {
+//		return db.Close()
+//	})
+//	<-stopCh
+//	err := c.Shutdown(shutdownCtx)
+type Coordinator struct {
+	logger *zap.Logger
+	mutex  sync.Mutex
+	phases map[Phase]*phase
+}
+
+type phase struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+	hooks   []hook
+}
+
+type hook struct {
+	name string
+	fn   ShutdownFunc
+}
+
+// NewCoordinator creates a Coordinator which runs the shutdown phases in order
+func NewCoordinator(logger *zap.Logger) *Coordinator {
+	return &Coordinator{
+		logger: logger.Named("lifecycle"),
+		phases: make(map[Phase]*phase),
+	}
+}
+
+// Go runs fn in a separate goroutine. The context passed to fn is cancelled once the given phase is shut down.
+// The phase is considered complete after fn has returned.
+func (c *Coordinator) Go(p Phase, name string, fn func(ctx context.Context)) {
+	ph := c.phase(p)
+	ph.running.Add(1)
+	go func() {
+		defer ph.running.Done()
+		fn(ph.ctx)
+		c.logger.Debug("component stopped", zap.String("component", name), zap.Int("phase", int(p)))
+	}()
+}
+
+// OnShutdown registers a ShutdownFunc which is executed when the given phase is shut down.
+// All functions of a phase are executed concurrently.
+func (c *Coordinator) OnShutdown(p Phase, name string, fn ShutdownFunc) {
+	ph := c.phase(p)
+	c.mutex.Lock()
+	ph.hooks = append(ph.hooks, hook{name: name, fn: fn})
+	c.mutex.Unlock()
+}
+
+// Shutdown shuts down all phases in ascending order. Every phase is awaited before the next one starts.
+// The passed context bounds the whole shutdown, if it expires the remaining phases are skipped.
+// All errors returned by the ShutdownFuncs are combined and returned.
+func (c *Coordinator) Shutdown(ctx context.Context) error {
+	c.mutex.Lock()
+	var order []Phase
+	for p := range c.phases {
+		order = append(order, p)
+	}
+	c.mutex.Unlock()
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+
+	var result error
+	for _, p := range order {
+		c.logger.Info("shutting down phase", zap.Int("phase", int(p)))
+		if err := c.shutdownPhase(ctx, c.phase(p)); err != nil {
+			result = multierr.Append(result, err)
+		}
+		if ctx.Err() != nil {
+			c.logger.Warn("shutdown deadline exceeded, skipping remaining phases", zap.Int("phase", int(p)))
+			return multierr.Append(result, errors.Wrapf(ctx.Err(), "shutdown of phase %d did not complete", p))
+		}
+	}
+
+	return result
+}
+
+// shutdownPhase cancels the phase context, executes the hooks and waits for everything to return
+func (c *Coordinator) shutdownPhase(ctx context.Context, ph *phase) error {
+	ph.cancel()
+
+	c.mutex.Lock()
+	hooks := ph.hooks
+	c.mutex.Unlock()
+
+	var (
+		result      error
+		resultMutex sync.Mutex
+		done        = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for _, h := range hooks {
+			wg.Add(1)
+			go func(h hook) {
+				defer wg.Done()
+				if err := h.fn(ctx); err != nil {
+					c.logger.Warn("shutdown failed", zap.String("component", h.name), zap.Error(err))
+					resultMutex.Lock()
+					result = multierr.Append(result, errors.Wrapf(err, "shutdown of %s failed", h.name))
+					resultMutex.Unlock()
+				}
+			}(h)
+		}
+		wg.Wait()
+		ph.running.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	resultMutex.Lock()
+	defer resultMutex.Unlock()
+	return result
+}
+
+// phase returns the phase p, it is created if it does not exist yet
+func (c *Coordinator) phase(p Phase) *phase {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ph, ok := c.phases[p]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		ph = &phase{ctx: ctx, cancel: cancel}
+		c.phases[p] = ph
+	}
+	return ph
+}
@@ -0,0 +1,24 @@
+package logging
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Field keys of the access-log schema which is shared by the HTTP and gRPC servers.
+// Log parsers can rely on these keys, regardless of the encoding of the logger.
+const (
+	FieldMethod     = "method"
+	FieldPath       = "path"
+	FieldFullMethod = "full_method"
+	FieldStatus     = "status"
+	FieldDurationMs = "duration_ms"
+	FieldRequestID  = "request_id"
+	FieldPeer       = "peer"
+)
+
+// DurationMs returns the duration as access-log field in (fractional) milliseconds
+func DurationMs(d time.Duration) zap.Field {
+	return zap.Float64(FieldDurationMs, float64(d)/float64(time.Millisecond))
+}
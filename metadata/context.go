@@ -0,0 +1,21 @@
+package metadata
+
+import (
+	"context"
+)
+
+// contextKey is the type of the context keys of this package, it cannot collide with keys of other packages
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+// WithRequestID returns a copy of the context which carries the request-id
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFromContext returns the request-id which has been stored with WithRequestID, e.g. by the RequestId interceptor
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey).(string)
+	return requestID, ok && requestID != ""
+}
@@ -12,6 +12,7 @@ const (
 	AccountID string = "accountId"
 	UserID    string = "userId"
 	TraceID    string = "zipkinTraceId"
+	IdempotencyKey string = "idempotencyKey"
 )
 
 // GetMetadata is a convenience function which can be used in order to not have to import two metadata
@@ -24,6 +25,7 @@ func GetMetadata(ctx context.Context) (metadata.MD, bool) {
 }
 
 // GetRequestID tries to extract the requestId key from the given context.
+// If no RequestID exists, an empty string is returned.
 func GetRequestID(ctx context.Context) string {
 
 	// try and find it in grpc metadata
@@ -35,12 +37,8 @@ func GetRequestID(ctx context.Context) string {
 	}
 
 	// requestId might also be in the context already (e.g. from an AMQP subscriber which does not have metadata)
-	requestId := ctx.Value(string(RequestID))
-	if requestId.(string) != "" {
-		return requestId.(string)
-	}
-
-	return ""
+	requestId, _ := RequestIDFromContext(ctx)
+	return requestId
 }
 
 // GetAccountID tries to extract the accountId key from the given context.
@@ -67,6 +65,18 @@ func GetUserID(ctx context.Context) string {
 	return ""
 }
 
+// GetIdempotencyKey tries to extract the idempotencyKey key from the given context.
+// If no IdempotencyKey exists, an empty string is returned
+func GetIdempotencyKey(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		key := md.Get(string(IdempotencyKey))
+		if len(key) > 0 {
+			return key[0]
+		}
+	}
+	return ""
+}
+
 // Has checks whether the passed key exists in the context metadata
 func Has(ctx context.Context, key string) bool {
 	if md, ok := metadata.FromIncomingContext(ctx); ok {
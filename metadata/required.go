@@ -0,0 +1,23 @@
+package metadata
+
+import (
+	"context"
+)
+
+type requiredKey struct{}
+
+// WithRequired stores the validated values of required metadata keys in the context.
+func WithRequired(ctx context.Context, values map[string]string) context.Context {
+	return context.WithValue(ctx, requiredKey{}, values)
+}
+
+// Required returns the value of a required metadata key which has been validated by the
+// interceptor.RequireMetadata interceptor. The second return value is false if the key has not been validated.
+func Required(ctx context.Context, key string) (string, bool) {
+	values, ok := ctx.Value(requiredKey{}).(map[string]string)
+	if !ok {
+		return "", false
+	}
+	value, ok := values[key]
+	return value, ok
+}
@@ -0,0 +1,26 @@
+package monitoring
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterRuntimeCollectors registers the Go runtime (go_*) and process (process_*) collectors
+// with the given registerer. The default registry already contains them, custom registries do not.
+// Collectors which are already registered are skipped.
+func RegisterRuntimeCollectors(registerer prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	}
+
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			if _, ok := err.(prometheus.AlreadyRegisteredError); ok {
+				continue
+			}
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package rabbitmq
+
+import (
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+// Address holds the components of an AMQP URI. Use it instead of concatenating the URI manually,
+// as the credentials and the vhost are escaped correctly.
+type Address struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Vhost    string
+	TLS      bool
+}
+
+// URI builds the AMQP URI. If no port is set, the default port of the scheme is used.
+// An empty vhost refers to the default vhost '/'.
+func (a Address) URI() string {
+	uri := amqp.URI{
+		Scheme:   "amqp",
+		Host:     a.Host,
+		Port:     a.Port,
+		Username: a.Username,
+		Password: a.Password,
+		Vhost:    a.Vhost,
+	}
+	if a.TLS {
+		uri.Scheme = "amqps"
+	}
+	if uri.Port == 0 {
+		uri.Port = 5672
+		if a.TLS {
+			uri.Port = 5671
+		}
+	}
+	if uri.Vhost == "" {
+		uri.Vhost = "/"
+	}
+	return uri.String()
+}
+
+// NewSessionFromAddress creates a new Session using the AMQP URI built from the address components.
+func NewSessionFromAddress(addr Address, logger *zap.Logger, options ...SessionOption) *Session {
+	return NewSession(addr.URI(), logger, options...)
+}
+
+// NewConnectionFromAddress creates a new Connection using the AMQP URI built from the address components.
+func NewConnectionFromAddress(addr Address, logger *zap.Logger, options ...ConnectionOption) *Connection {
+	return NewConnection(addr.URI(), logger, options...)
+}
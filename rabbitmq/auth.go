@@ -0,0 +1,13 @@
+package rabbitmq
+
+// ExternalAuth implements the SASL EXTERNAL mechanism (amqp.Authentication).
+// The broker derives the identity from the TLS client certificate, so it must be used together with WithTLSConfig.
+type ExternalAuth struct{}
+
+func (ExternalAuth) Mechanism() string {
+	return "EXTERNAL"
+}
+
+func (ExternalAuth) Response() string {
+	return ""
+}
@@ -0,0 +1,188 @@
+package rabbitmq
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// latencyWindow is the amount of handler durations the p99 latency is calculated from
+const latencyWindow = 100
+
+var (
+	backpressureActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "amqp_consumer_backpressure_active",
+		Help: "1 if the consumer of the queue currently applies backpressure, 0 otherwise",
+	}, []string{"queue"})
+	backpressureEngaged = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "amqp_consumer_backpressure_engaged_total",
+		Help: "Number of times the consumer of the queue started to apply backpressure",
+	}, []string{"queue"})
+	registerBackpressureMetrics sync.Once
+)
+
+// Backpressure configures when the consumer stops reading deliveries.
+// While backpressure is applied, the broker stops sending deliveries once the prefetch count is reached.
+type Backpressure struct {
+	// MaxInFlight pauses consuming while this amount of deliveries is dispatched but not yet handled, 0 disables it
+	MaxInFlight int
+	// MaxLatencyP99 pauses consuming for the Cooldown if the p99 of the recent handler durations exceeds it, 0 disables it
+	MaxLatencyP99 time.Duration
+	// Cooldown is the duration consuming is paused after the latency threshold has been exceeded
+	Cooldown time.Duration
+}
+
+// backpressure tracks the in-flight deliveries and handler latencies and blocks the dispatching
+// of new deliveries while one of the thresholds is exceeded.
+type backpressure struct {
+	mutex       sync.Mutex
+	logger      *zap.Logger
+	config      Backpressure
+	inFlight    int
+	samples     []time.Duration
+	next        int
+	pausedUntil time.Time
+	engaged     bool
+	changed     chan struct{}
+	active      prometheus.Gauge
+	engagements prometheus.Counter
+}
+
+func newBackpressure(logger *zap.Logger, queue string, config Backpressure) *backpressure {
+	registerBackpressureMetrics.Do(func() {
+		_ = prometheus.Register(backpressureActive)
+		_ = prometheus.Register(backpressureEngaged)
+	})
+
+	return &backpressure{
+		logger:      logger,
+		config:      config,
+		changed:     make(chan struct{}),
+		active:      backpressureActive.WithLabelValues(queue),
+		engagements: backpressureEngaged.WithLabelValues(queue),
+	}
+}
+
+// acquire blocks until no threshold is exceeded and then counts a new in-flight delivery.
+// It returns false if the context has been cancelled while waiting.
+func (b *backpressure) acquire(ctx context.Context) bool {
+	for {
+		b.mutex.Lock()
+		blocked, until := b.blocked()
+		b.setEngaged(blocked)
+		if !blocked {
+			b.inFlight++
+			b.mutex.Unlock()
+			return true
+		}
+		changed := b.changed
+		b.mutex.Unlock()
+
+		if !b.wait(ctx, changed, until) {
+			return false
+		}
+	}
+}
+
+// wait blocks until the state changed, the time is reached or the context is cancelled
+func (b *backpressure) wait(ctx context.Context, changed <-chan struct{}, until time.Time) bool {
+	var timeout <-chan time.Time
+	if !until.IsZero() {
+		timer := time.NewTimer(time.Until(until))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-changed:
+	case <-timeout:
+	}
+	return true
+}
+
+// release marks a delivery as handled and records the duration of the handler
+func (b *backpressure) release(duration time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.inFlight--
+	if b.config.MaxLatencyP99 > 0 {
+		b.record(duration)
+	}
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// abort releases an acquired delivery which has not been handled, no duration is recorded
+func (b *backpressure) abort() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.inFlight--
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// blocked reports whether dispatching must wait. If it must wait until a specific time, it is returned as well.
+func (b *backpressure) blocked() (bool, time.Time) {
+	if time.Now().Before(b.pausedUntil) {
+		return true, b.pausedUntil
+	}
+	if b.config.MaxInFlight > 0 && b.inFlight >= b.config.MaxInFlight {
+		return true, time.Time{}
+	}
+	return false, time.Time{}
+}
+
+// record adds the duration to the latency window. If the window is full and its p99 exceeds
+// the threshold, consuming is paused for the cooldown and the window is reset.
+func (b *backpressure) record(duration time.Duration) {
+	if len(b.samples) < latencyWindow {
+		b.samples = append(b.samples, duration)
+	} else {
+		b.samples[b.next] = duration
+		b.next = (b.next + 1) % latencyWindow
+	}
+	if len(b.samples) < latencyWindow {
+		return
+	}
+
+	sorted := make([]time.Duration, len(b.samples))
+	copy(sorted, b.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	p99 := sorted[len(sorted)*99/100]
+
+	if p99 > b.config.MaxLatencyP99 {
+		b.logger.Warn("handler p99 latency exceeds threshold, pausing consumption",
+			zap.Duration("p99", p99),
+			zap.Duration("threshold", b.config.MaxLatencyP99),
+			zap.Duration("cooldown", b.config.Cooldown))
+		b.pausedUntil = time.Now().Add(b.config.Cooldown)
+		b.samples = b.samples[:0]
+		b.next = 0
+	}
+}
+
+// setEngaged updates the metrics and logs if the backpressure state changes
+func (b *backpressure) setEngaged(engaged bool) {
+	if engaged == b.engaged {
+		return
+	}
+	b.engaged = engaged
+
+	if engaged {
+		b.logger.Warn("consumer backpressure engaged", zap.Int("inFlight", b.inFlight))
+		b.engagements.Inc()
+		b.active.Set(1)
+		return
+	}
+	b.logger.Info("consumer backpressure released")
+	b.active.Set(0)
+}
@@ -0,0 +1,162 @@
+package rabbitmq
+
+import (
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+// ackBatcher implements amqp.Acknowledger. Acks of the handlers are collected and sent as a single
+// multi-ack once the batch size is reached or the flush interval elapsed. Only the highest tag up to
+// which every delivery has been settled is acked, so a delivery which is still being processed is never
+// acked by accident. Nacks and rejects are passed through immediately.
+type ackBatcher struct {
+	mutex      sync.Mutex
+	logger     *zap.Logger
+	acker      amqp.Acknowledger
+	size       int
+	contiguous uint64          // every tag up to (and including) contiguous is settled
+	settled    map[uint64]bool // settled tags above contiguous, true if they await an ack
+	pending    uint64          // the highest acked tag which has not been sent to the broker yet
+	count      int
+	stop       chan struct{}
+	stopped    sync.WaitGroup
+}
+
+func newAckBatcher(logger *zap.Logger, size int, interval time.Duration) *ackBatcher {
+	b := &ackBatcher{
+		logger:  logger,
+		size:    size,
+		settled: make(map[uint64]bool),
+		stop:    make(chan struct{}),
+	}
+
+	if interval > 0 {
+		b.stopped.Add(1)
+		go func() {
+			defer b.stopped.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-b.stop:
+					return
+				case <-ticker.C:
+					b.mutex.Lock()
+					b.flush()
+					b.mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	return b
+}
+
+// wrap replaces the acknowledger of the delivery with the batcher
+func (b *ackBatcher) wrap(delivery amqp.Delivery) amqp.Delivery {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.acker == nil {
+		b.acker = delivery.Acknowledger
+		b.contiguous = delivery.DeliveryTag - 1
+	}
+	delivery.Acknowledger = b
+	return delivery
+}
+
+func (b *ackBatcher) Ack(tag uint64, multiple bool) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if multiple {
+		b.settleUpTo(tag)
+		b.pending = 0
+		return b.acker.Ack(tag, true)
+	}
+
+	b.settled[tag] = true
+	b.count++
+	b.advance()
+	if b.count >= b.size {
+		b.flush()
+	}
+	return nil
+}
+
+func (b *ackBatcher) Nack(tag uint64, multiple bool, requeue bool) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	// acks collected so far must be sent first, a multi-nack would otherwise include them
+	b.flush()
+	if multiple {
+		b.settleUpTo(tag)
+	} else {
+		b.settled[tag] = false
+		b.advance()
+	}
+	return b.acker.Nack(tag, multiple, requeue)
+}
+
+func (b *ackBatcher) Reject(tag uint64, requeue bool) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.settled[tag] = false
+	b.advance()
+	return b.acker.Reject(tag, requeue)
+}
+
+// Close stops the flush interval and sends the remaining acks
+func (b *ackBatcher) Close() {
+	close(b.stop)
+	b.stopped.Wait()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.flush()
+}
+
+// advance moves the contiguous tag forward as long as the following tags are settled
+func (b *ackBatcher) advance() {
+	for {
+		ack, ok := b.settled[b.contiguous+1]
+		if !ok {
+			return
+		}
+		b.contiguous++
+		delete(b.settled, b.contiguous)
+		if ack {
+			b.pending = b.contiguous
+		}
+	}
+}
+
+// settleUpTo marks every tag up to the given tag as settled by the broker
+func (b *ackBatcher) settleUpTo(tag uint64) {
+	for t := range b.settled {
+		if t <= tag {
+			delete(b.settled, t)
+		}
+	}
+	if tag > b.contiguous {
+		b.contiguous = tag
+	}
+	b.advance()
+}
+
+// flush sends a multi-ack for all contiguous acked deliveries. The mutex must be held.
+func (b *ackBatcher) flush() {
+	b.count = 0
+	if b.pending == 0 || b.acker == nil {
+		return
+	}
+	if err := b.acker.Ack(b.pending, true); err != nil {
+		b.logger.Warn("failed to send batched ack", zap.Uint64("deliveryTag", b.pending), zap.Error(err))
+	}
+	b.pending = 0
+}
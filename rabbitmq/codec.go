@@ -0,0 +1,66 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	ContentTypeOctetStream = "application/octet-stream"
+	ContentTypeProtobuf    = "application/x-protobuf"
+	ContentTypeJSON        = "application/json"
+)
+
+// Codec is used to encode and decode message bodies.
+// Marshal also returns the content type of the encoded body.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, string, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// ContentTyper is implemented by codecs which always encode to the same content type
+type ContentTyper interface {
+	ContentType() string
+}
+
+// ProtobufCodec encodes proto.Message values using the protobuf wire format
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, string, error) {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return nil, "", fmt.Errorf("cannot marshal %T, it is not a proto.Message", v)
+	}
+	body, err := proto.Marshal(message)
+	return body, ContentTypeOctetStream, err
+}
+
+func (ProtobufCodec) ContentType() string {
+	return ContentTypeOctetStream
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T, it is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, message)
+}
+
+// JSONCodec encodes values using encoding/json
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, string, error) {
+	body, err := json.Marshal(v)
+	return body, ContentTypeJSON, err
+}
+
+func (JSONCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,183 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/streadway/amqp"
+)
+
+var (
+	publishUnconfirmed = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "amqp_publisher_unconfirmed_messages",
+		Help: "Number of published messages which have not been confirmed by the broker yet",
+	})
+	registerConfirmMetrics sync.Once
+)
+
+// WithPublisherConfirms puts the publish channel into confirm mode, Publish then only returns after the
+// broker confirmed the message, with ErrPublishNacked if the broker rejected it or with ErrConfirmTimeout.
+// At most maxInFlight messages are awaiting their confirmation, further publishes block until
+// a confirmation arrives or the publish timeout elapsed. A maxInFlight of 0 does not limit the publishes.
+func WithPublisherConfirms(maxInFlight int) SessionOption {
+	return func(options *SessionOptions) {
+		options.PublisherConfirms = true
+		options.MaxInFlightConfirms = maxInFlight
+	}
+}
+
+// DefaultConfirmTimeout is the default time Publish waits for the confirmation of the broker
+const DefaultConfirmTimeout = 5 * time.Second
+
+// WithConfirmTimeout sets the time a confirmed publish waits for the confirmation of the broker before
+// it fails with ErrConfirmTimeout. It defaults to DefaultConfirmTimeout, 0 waits until the channel is closed.
+func WithConfirmTimeout(timeout time.Duration) SessionOption {
+	return func(options *SessionOptions) {
+		options.ConfirmTimeout = timeout
+	}
+}
+
+// confirmTracker assigns the delivery tags of a channel in confirm mode and routes the
+// confirmations of the broker to the waiting publishes
+type confirmTracker struct {
+	mutex   sync.Mutex
+	next    uint64
+	pending map[uint64]chan bool
+	broken  bool
+}
+
+// newConfirmTracker puts the channel into confirm mode and starts listening for confirmations
+func newConfirmTracker(ch *amqp.Channel) (*confirmTracker, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to put publish channel into confirm mode: %w", err)
+	}
+	registerConfirmMetrics.Do(func() {
+		prometheus.MustRegister(publishUnconfirmed)
+	})
+
+	t := &confirmTracker{
+		next:    1,
+		pending: make(map[uint64]chan bool),
+	}
+	go t.listen(ch.NotifyPublish(make(chan amqp.Confirmation, 128)))
+	return t, nil
+}
+
+// publish registers confirmed for the next delivery tag and calls the publish func.
+// Only the tag assignment and the publish are serialized, as delivery tags are assigned by the channel
+// in publish order. If a publish fails, the delivery tags cannot be tracked anymore,
+// so the tracker refuses all further publishes and the channel has to be replaced.
+func (t *confirmTracker) publish(confirmed chan bool, publish func() error) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.broken {
+		return fmt.Errorf("publish channel is being replaced: %w", ErrNotConnected)
+	}
+	t.pending[t.next] = confirmed
+	if err := publish(); err != nil {
+		delete(t.pending, t.next)
+		t.broken = true
+		return err
+	}
+	t.next++
+	publishUnconfirmed.Inc()
+	return nil
+}
+
+// listen resolves the pending publishes until the channel is closed, then all remaining publishes fail
+func (t *confirmTracker) listen(confirmations <-chan amqp.Confirmation) {
+	for confirmation := range confirmations {
+		t.mutex.Lock()
+		if confirmed, ok := t.pending[confirmation.DeliveryTag]; ok {
+			delete(t.pending, confirmation.DeliveryTag)
+			confirmed <- confirmation.Ack
+			publishUnconfirmed.Dec()
+		}
+		t.mutex.Unlock()
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for tag, confirmed := range t.pending {
+		delete(t.pending, tag)
+		close(confirmed)
+		publishUnconfirmed.Dec()
+	}
+}
+
+// acquireConfirmSlot blocks until less than MaxInFlightConfirms publishes await their confirmation
+func (s *Session) acquireConfirmSlot() error {
+	if s.confirmSlots == nil {
+		return nil
+	}
+
+	var timeout <-chan time.Time
+	if s.opts.PublishTimeout > 0 {
+		timer := time.NewTimer(s.opts.PublishTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case s.confirmSlots <- struct{}{}:
+		return nil
+	case <-s.ctx.Done():
+		return fmt.Errorf("session shut down while waiting for unconfirmed publishes: %w", ErrSessionClosed)
+	case <-timeout:
+		return fmt.Errorf("%d publishes still unconfirmed after %s: %w",
+			s.opts.MaxInFlightConfirms, s.opts.PublishTimeout, ErrPublishTimeout)
+	}
+}
+
+func (s *Session) releaseConfirmSlot() {
+	if s.confirmSlots != nil {
+		<-s.confirmSlots
+	}
+}
+
+// publishConfirmed publishes on a channel in confirm mode and waits for the confirmation of the broker
+func (s *Session) publishConfirmed(ch *amqp.Channel, confirms *confirmTracker, exchange, routingKey string, publishing amqp.Publishing) error {
+	if err := s.acquireConfirmSlot(); err != nil {
+		return err
+	}
+	defer s.releaseConfirmSlot()
+
+	// the publish keeps its delivery tag if it times out, a late confirmation is discarded
+	confirmed := make(chan bool, 1)
+	err := s.withPublishTimeout(exchange, func() error {
+		return confirms.publish(confirmed, func() error {
+			return ch.Publish(exchange, routingKey, false, false, publishing)
+		})
+	})
+	if errors.Is(err, ErrPublishTimeout) {
+		return err
+	}
+	if err != nil {
+		// closing the channel fails all pending publishes and a new channel is opened by the next publish
+		_ = ch.Close()
+		return err
+	}
+
+	var timeout <-chan time.Time
+	if s.opts.ConfirmTimeout > 0 {
+		timer := time.NewTimer(s.opts.ConfirmTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case ack, ok := <-confirmed:
+		if !ok {
+			return fmt.Errorf("publish channel closed before the broker confirmed the message: %w", ErrNotConnected)
+		}
+		if !ack {
+			return fmt.Errorf("message to exchange %s was rejected: %w", exchange, ErrPublishNacked)
+		}
+		return nil
+	case <-timeout:
+		return fmt.Errorf("message to exchange %s was not confirmed within %s: %w",
+			exchange, s.opts.ConfirmTimeout, ErrConfirmTimeout)
+	}
+}
@@ -20,13 +20,38 @@ type Connection struct {
 	cancel                context.CancelFunc
 	connected             bool
 	notifyCloseConnection chan *amqp.Error
+	errorHandler          func(*amqp.Error)
+	reconnectHandler      func()
+	blockedHandler        func(amqp.Blocking)
+	opts                  *ConnectionOptions
+	monitors              sync.WaitGroup
 }
 
+// ReconnectDelay is the default delay between two reconnection attempts
 const ReconnectDelay = 5 * time.Second
 
-func NewConnection(addr string, logger *zap.Logger) *Connection {
+// DefaultHeartbeat, DefaultLocale and DefaultDialTimeout match the defaults of amqp.Dial
+const (
+	DefaultHeartbeat   = 10 * time.Second
+	DefaultLocale      = "en_US"
+	DefaultDialTimeout = 30 * time.Second
+)
+
+func NewConnection(addr string, logger *zap.Logger, options ...ConnectionOption) *Connection {
+	args := &ConnectionOptions{
+		ReconnectDelay: ReconnectDelay,
+		Heartbeat:      DefaultHeartbeat,
+		Locale:         DefaultLocale,
+		DialTimeout:    DefaultDialTimeout,
+	}
+
+	for _, opt := range options {
+		opt(args)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	c := &Connection{
+		opts:                  args,
 		ctx:                   ctx,
 		logger:                logger,
 		cancel:                cancel,
@@ -45,11 +70,34 @@ func (c *Connection) Connect() (err error) {
 		return errors.Wrap(err, "unable to connect to amqp server")
 	}
 
-	go c.monitorConnection()
+	c.monitors.Add(1)
+	go func() {
+		defer c.monitors.Done()
+		c.monitorConnection()
+	}()
 
 	return nil
 }
 
+// ConnectInBackground keeps dialing the AMQP server until a connection is established or Shutdown is called,
+// e.g. after Connect failed. Once connected, the connection is monitored like after Connect and the
+// OnReconnect handler is called.
+func (c *Connection) ConnectInBackground() {
+	c.monitors.Add(1)
+	go func() {
+		defer c.monitors.Done()
+		c.reconnect()
+		if c.IsConnected() {
+			c.monitorConnection()
+		}
+	}()
+}
+
+// Wait blocks until the reconnect monitor has exited after Shutdown
+func (c *Connection) Wait() {
+	c.monitors.Wait()
+}
+
 // Shutdown the reconnector and terminate any existing connections
 func (c *Connection) Shutdown() {
 	c.setConnected(false)
@@ -68,7 +116,7 @@ func (c *Connection) Shutdown() {
 func (c *Connection) dial() (*amqp.Connection, error) {
 	c.setConnected(false)
 
-	conn, err := amqp.Dial(c.addr)
+	conn, err := amqp.DialConfig(c.addr, c.config())
 	if err != nil {
 		return nil, err
 	}
@@ -77,6 +125,17 @@ func (c *Connection) dial() (*amqp.Connection, error) {
 	return conn, nil
 }
 
+// config builds the amqp.Config from the connection options
+func (c *Connection) config() amqp.Config {
+	return amqp.Config{
+		SASL:            c.opts.SASL,
+		TLSClientConfig: c.opts.TLSConfig,
+		Heartbeat:       c.opts.Heartbeat,
+		Locale:          c.opts.Locale,
+		Dial:            amqp.DefaultDial(c.opts.DialTimeout),
+	}
+}
+
 // monitorConnection ensures that the amqp connection is recovered on failures.
 // if an error can be read from the amqp connectionClosed channel, then reconnect() is called
 func (c *Connection) monitorConnection() {
@@ -89,6 +148,9 @@ func (c *Connection) monitorConnection() {
 				c.logger.Warn("amqp connection error",
 					zap.String("err.reason", amqpErr.Reason),
 					zap.Int("err.code", amqpErr.Code))
+				if handler := c.getErrorHandler(); handler != nil {
+					go handler(amqpErr)
+				}
 				c.reconnect()
 			}
 		}
@@ -109,11 +171,14 @@ func (c *Connection) reconnect() {
 		c.conn, err = c.dial()
 		if err != nil {
 			c.logger.Warn("unable to connect to amqp server", zap.Error(err))
-			time.Sleep(ReconnectDelay)
+			time.Sleep(c.opts.ReconnectDelay)
 			continue
 		}
 		c.logger.Info("reconnected to amqp server")
 		c.setConnected(true)
+		if handler := c.getReconnectHandler(); handler != nil {
+			go handler()
+		}
 		return
 	}
 }
@@ -126,6 +191,62 @@ func (c *Connection) changeConnection(connection *amqp.Connection) {
 	c.conn = connection
 	c.notifyCloseConnection = make(chan *amqp.Error)
 	c.conn.NotifyClose(c.notifyCloseConnection)
+	go c.watchBlocked(c.conn.NotifyBlocked(make(chan amqp.Blocking, 1)))
+}
+
+// watchBlocked passes the connection.blocked notifications to the OnBlocked handler until the connection is closed.
+// A closed connection is reported as unblocked, the next connection starts out unblocked.
+func (c *Connection) watchBlocked(blocked <-chan amqp.Blocking) {
+	for blocking := range blocked {
+		if handler := c.getBlockedHandler(); handler != nil {
+			handler(blocking)
+		}
+	}
+	if handler := c.getBlockedHandler(); handler != nil {
+		handler(amqp.Blocking{Active: false})
+	}
+}
+
+// OnError registers a handler which is called whenever the connection is closed with an error.
+// The handler runs in its own goroutine, so it cannot block the reconnection.
+func (c *Connection) OnError(handler func(*amqp.Error)) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.errorHandler = handler
+}
+
+func (c *Connection) getErrorHandler() func(*amqp.Error) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	return c.errorHandler
+}
+
+// OnReconnect registers a handler which is called whenever the connection has been recovered.
+// The handler runs in its own goroutine.
+func (c *Connection) OnReconnect(handler func()) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.reconnectHandler = handler
+}
+
+func (c *Connection) getReconnectHandler() func() {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	return c.reconnectHandler
+}
+
+// OnBlocked registers a handler which is called whenever the broker blocks or unblocks the connection
+// using connection.blocked, e.g. because of a resource alarm. It must be registered before Connect.
+func (c *Connection) OnBlocked(handler func(amqp.Blocking)) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	c.blockedHandler = handler
+}
+
+func (c *Connection) getBlockedHandler() func(amqp.Blocking) {
+	c.connMutex.Lock()
+	defer c.connMutex.Unlock()
+	return c.blockedHandler
 }
 
 func (c *Connection) IsConnected() bool {
@@ -140,8 +261,12 @@ func (c *Connection) setConnected(status bool) {
 	c.connected = status
 }
 
+// Channel opens a new channel, ErrNotConnected is returned while the connection is offline
 func (c *Connection) Channel() (*amqp.Channel, error) {
 	c.connMutex.Lock()
 	defer c.connMutex.Unlock()
+	if !c.connected || c.conn == nil {
+		return nil, ErrNotConnected
+	}
 	return c.conn.Channel()
 }
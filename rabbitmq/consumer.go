@@ -0,0 +1,83 @@
+package rabbitmq
+
+import (
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// queueConsumer holds the subscriptions of a single queue and the state of its consume loop.
+// Every queue of a session is consumed on its own channel, so it can be paused independently.
+type queueConsumer struct {
+	queue         string
+	tag           string
+	subscribers   map[string]ContextSubscriber
+	subscriptions []SubscriptionInfo
+	mutex         sync.Mutex
+	channel       *amqp.Channel
+	consuming     chan struct{}
+	resume        chan struct{}
+}
+
+func newQueueConsumer(queue, tag string) *queueConsumer {
+	return &queueConsumer{
+		queue:       queue,
+		tag:         tag,
+		subscribers: make(map[string]ContextSubscriber),
+	}
+}
+
+// subscribe registers the handler for the routing key
+func (c *queueConsumer) subscribe(subscription SubscriptionInfo, handler ContextSubscriber) {
+	c.subscribers[subscription.RoutingKey] = handler
+	c.subscriptions = append(c.subscriptions, subscription)
+}
+
+// pause makes the consume loop wait until resume is called. It returns the channel which is currently
+// consumed from and a channel which is closed once all of its deliveries have been handled.
+func (c *queueConsumer) pause() (*amqp.Channel, chan struct{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.resume == nil {
+		c.resume = make(chan struct{})
+	}
+	return c.channel, c.consuming
+}
+
+// unpause lets a paused consume loop continue
+func (c *queueConsumer) unpause() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.resume != nil {
+		close(c.resume)
+		c.resume = nil
+	}
+}
+
+// pausedUntil returns a channel which is closed by unpause if the consumer is paused, nil otherwise
+func (c *queueConsumer) pausedUntil() <-chan struct{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.resume
+}
+
+// start remembers the channel which is currently consumed from. The returned channel
+// is closed by stop once all deliveries have been handled.
+func (c *queueConsumer) start(ch *amqp.Channel) chan struct{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.channel = ch
+	c.consuming = make(chan struct{})
+	return c.consuming
+}
+
+func (c *queueConsumer) stop(stopped chan struct{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.channel = nil
+	close(stopped)
+}
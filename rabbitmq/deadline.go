@@ -0,0 +1,43 @@
+package rabbitmq
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+// DefaultDeadlineHeader is the header which is read to determine the deadline of a delivery
+const DefaultDeadlineHeader = "x-deadline"
+
+// deliveryDeadline determines until when the delivery must be processed.
+// The deadline header may either be a timestamp, an RFC3339 string or the unix time in milliseconds.
+// If the header is missing, the deadline is derived from the timestamp and expiration properties.
+func (s *Session) deliveryDeadline(delivery amqp.Delivery) (time.Time, bool) {
+	if value, ok := delivery.Headers[s.opts.DeadlineHeader]; ok {
+		switch v := value.(type) {
+		case time.Time:
+			return v, true
+		case string:
+			if deadline, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return deadline, true
+			}
+		case int64:
+			return time.Unix(0, v*int64(time.Millisecond)), true
+		case int32:
+			return time.Unix(0, int64(v)*int64(time.Millisecond)), true
+		}
+		s.logger.Warn("unable to parse delivery deadline, ignoring it",
+			zap.String("header", s.opts.DeadlineHeader),
+			zap.Any("value", value))
+	}
+
+	if delivery.Expiration != "" && !delivery.Timestamp.IsZero() {
+		if ttl, err := strconv.ParseInt(delivery.Expiration, 10, 64); err == nil {
+			return delivery.Timestamp.Add(time.Duration(ttl) * time.Millisecond), true
+		}
+	}
+
+	return time.Time{}, false
+}
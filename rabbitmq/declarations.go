@@ -1,12 +1,18 @@
 package rabbitmq
 
-
 import (
+	"context"
+
 	"github.com/streadway/amqp"
 )
 
 type Declaration func(Declarator) error
 type Subscriber func(delivery amqp.Delivery)
+type TypedSubscriber func(delivery amqp.Delivery, message interface{})
+type ContextSubscriber func(ctx context.Context, delivery amqp.Delivery)
+type EventSubscriber func(ctx context.Context, delivery amqp.Delivery, event Event)
+type RetrySubscriber func(ctx context.Context, delivery amqp.Delivery) error
+type SubscriberFunc func(delivery amqp.Delivery) error
 
 // Declarator is implemented by amqp.Channel
 type Declarator interface {
@@ -28,6 +34,7 @@ type Exchange struct {
 	durable    bool
 	autoDelete bool
 	exclusive  bool
+	internal   bool
 	noWait     bool
 	args       amqp.Table
 }
@@ -52,6 +59,52 @@ func AutoQueue(name string) Declaration {
 	})
 }
 
+// QueueWithArgs declares a queue with explicit flags and arguments, it allows setting any
+// argument the broker supports (e.g. x-queue-type, x-message-ttl or x-max-length) without a dedicated helper.
+func QueueWithArgs(name string, durable, autoDelete, exclusive bool, args amqp.Table) Declaration {
+	return DeclareQueue(&Queue{
+		name:       name,
+		durable:    durable,
+		autoDelete: autoDelete,
+		exclusive:  exclusive,
+		args:       args,
+	})
+}
+
+// Queue arguments which configure dead-lettering
+const (
+	DeadLetterExchangeArgument   = "x-dead-letter-exchange"
+	DeadLetterRoutingKeyArgument = "x-dead-letter-routing-key"
+)
+
+// DeadLetterQueueSuffix is appended to the name of a queue to name its dead-letter queue
+const DeadLetterQueueSuffix = ".dlq"
+
+// AutoQueueWithDLX declares a queue like AutoQueue whose rejected and expired messages are published
+// to the dead-letter exchange. If deadLetterRoutingKey is empty, the original routing key is kept.
+func AutoQueueWithDLX(name, deadLetterExchange, deadLetterRoutingKey string) Declaration {
+	args := amqp.Table{DeadLetterExchangeArgument: deadLetterExchange}
+	if deadLetterRoutingKey != "" {
+		args[DeadLetterRoutingKeyArgument] = deadLetterRoutingKey
+	}
+	return QueueWithArgs(name, true, false, false, args)
+}
+
+// AutoDeadLetter declares the dead-letter exchange as topic exchange together with the dead-letter queue
+// of the given queue, which is bound to receive all dead-lettered messages.
+func AutoDeadLetter(deadLetterExchange, queue string) Declaration {
+	return func(d Declarator) error {
+		deadLetterQueue := queue + DeadLetterQueueSuffix
+		if err := AutoExchange(deadLetterExchange)(d); err != nil {
+			return err
+		}
+		if err := AutoQueue(deadLetterQueue)(d); err != nil {
+			return err
+		}
+		return AutoBinding("#", deadLetterQueue, deadLetterExchange)(d)
+	}
+}
+
 func DeclareQueue(q *Queue) Declaration {
 	return func(d Declarator) error {
 		_, err := d.QueueDeclare(
@@ -78,14 +131,50 @@ func AutoExchange(name string) Declaration {
 	})
 }
 
+// AlternateExchangeArgument is the exchange argument naming the exchange for unroutable messages
+const AlternateExchangeArgument = "alternate-exchange"
+
+// AutoExchangeWithAlternate declares a topic exchange like AutoExchange whose unroutable messages,
+// which match no binding, are routed to the alternate exchange instead of being dropped.
+// The alternate exchange is declared as fanout exchange with a durable queue of the same name,
+// so that the captured messages can be inspected later.
+// An existing exchange cannot be redeclared with different arguments, the broker rejects it.
+func AutoExchangeWithAlternate(name, alternate string) Declaration {
+	return func(d Declarator) error {
+		if err := ExchangeWithArgs(alternate, "fanout", true, false, false, nil)(d); err != nil {
+			return err
+		}
+		if err := AutoQueue(alternate)(d); err != nil {
+			return err
+		}
+		if err := AutoBinding("", alternate, alternate)(d); err != nil {
+			return err
+		}
+		return ExchangeWithArgs(name, "topic", true, false, false, amqp.Table{AlternateExchangeArgument: alternate})(d)
+	}
+}
+
+// ExchangeWithArgs declares an exchange with explicit flags and arguments, it allows setting any
+// argument the broker supports (e.g. alternate-exchange) without a dedicated helper.
+func ExchangeWithArgs(name, kind string, durable, autoDelete, internal bool, args amqp.Table) Declaration {
+	return DeclareExchange(&Exchange{
+		name:       name,
+		kind:       kind,
+		durable:    durable,
+		autoDelete: autoDelete,
+		internal:   internal,
+		args:       args,
+	})
+}
+
 func DeclareExchange(e *Exchange) Declaration {
 	return func(d Declarator) error {
 		return d.ExchangeDeclare(
 			e.name,
 			e.kind,
 			e.durable,
-			e.exclusive,
 			e.autoDelete,
+			e.internal,
 			e.noWait,
 			e.args,
 		)
@@ -101,6 +190,16 @@ func AutoBinding(routingKey, queue, exchange string) Declaration {
 	})
 }
 
+// BindingWithArgs binds the queue to the exchange with explicit arguments (e.g. for headers exchanges)
+func BindingWithArgs(routingKey, queue, exchange string, args amqp.Table) Declaration {
+	return DeclareBinding(&Binding{
+		exchange:   Exchange{name: exchange},
+		queue:      Queue{name: queue},
+		routingKey: routingKey,
+		args:       args,
+	})
+}
+
 func DeclareBinding(b *Binding) Declaration {
 	return func(d Declarator) error {
 		return d.QueueBind(
@@ -111,4 +210,4 @@ func DeclareBinding(b *Binding) Declaration {
 			b.args,
 		)
 	}
-}
\ No newline at end of file
+}
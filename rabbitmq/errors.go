@@ -0,0 +1,66 @@
+package rabbitmq
+
+import (
+	"errors"
+)
+
+// ErrNotConnected is returned if the required amqp connection has not been established or is currently offline
+var ErrNotConnected = errors.New("amqp connection not established")
+
+// ErrInvalidOption is returned by a session which was created with an invalid SessionOption
+var ErrInvalidOption = errors.New("invalid session option")
+
+// ErrUnknownRoutingKey is returned by Publish if no publisher is registered for the routing key
+var ErrUnknownRoutingKey = errors.New("unknown routing key")
+
+// ErrUnknownQueue is returned if no subscription consumes from the queue
+var ErrUnknownQueue = errors.New("unknown queue")
+
+// ErrMarshal is returned if an event cannot be marshaled, retrying will not help
+var ErrMarshal = errors.New("failed to marshal event")
+
+// ErrMessageTooLarge is returned if the body of a message exceeds the configured maximum message size
+var ErrMessageTooLarge = errors.New("message exceeds the maximum message size")
+
+// ErrSessionClosed is returned if the session was shut down while a publish was waiting
+var ErrSessionClosed = errors.New("amqp session shut down")
+
+// ErrPublishTimeout is returned if a message could not be published within the publish timeout.
+// The message may still be published afterwards, consumers have to tolerate duplicates if publishes are retried.
+var ErrPublishTimeout = errors.New("publish timed out")
+
+// ErrPublishNacked is returned if the broker rejected a published message, see WithPublisherConfirms
+var ErrPublishNacked = errors.New("publish rejected by broker")
+
+// ErrConfirmTimeout is returned if the broker did not confirm a published message within the confirm timeout
+var ErrConfirmTimeout = errors.New("publish confirmation timed out")
+
+// ErrFlowPaused is returned if the broker paused the publish channel and did not resume it in time
+var ErrFlowPaused = errors.New("publish channel paused by broker")
+
+// ErrPublishBufferFull is returned if the producer connection is offline and the publish buffer is full
+var ErrPublishBufferFull = errors.New("publish buffer is full")
+
+// ErrTransient classifies handler errors which are worth retrying, see Transient and RetryPolicy
+var ErrTransient = errors.New("transient error")
+
+// Transient marks err as transient, a RetryPolicy will requeue the delivery instead of dead-lettering it
+func Transient(err error) error {
+	return transientError{err: err}
+}
+
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e transientError) Unwrap() error {
+	return e.err
+}
+
+func (e transientError) Is(target error) bool {
+	return target == ErrTransient
+}
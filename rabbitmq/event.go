@@ -0,0 +1,72 @@
+package rabbitmq
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+)
+
+// Event is the standard envelope of a message. The metadata is mapped to the AMQP properties
+// (message-id, type, timestamp, app-id and correlation-id), the payload is encoded as body.
+// Publish an Event by passing it instead of the bare payload:
+//
+//	session.Publish("user.created", rabbitmq.Event{Payload: msg, CorrelationID: requestID})
+type Event struct {
+	// ID defaults to a random UUID
+	ID string
+	// Type defaults to the full name of the proto message
+	Type string
+	// Timestamp defaults to the time of publishing
+	Timestamp time.Time
+	// Source defaults to the service name of the session
+	Source        string
+	CorrelationID string
+	Payload       interface{}
+}
+
+// EventFromDelivery reads the envelope metadata from the properties of the delivery.
+// The payload is not decoded, use AddEventSubscription to receive decoded events.
+func EventFromDelivery(delivery amqp.Delivery) Event {
+	return Event{
+		ID:            delivery.MessageId,
+		Type:          delivery.Type,
+		Timestamp:     delivery.Timestamp,
+		Source:        delivery.AppId,
+		CorrelationID: delivery.CorrelationId,
+	}
+}
+
+// apply maps the envelope metadata to the publishing properties, unset fields keep the defaults
+func (e Event) apply(publishing *amqp.Publishing) {
+	publishing.MessageId = e.ID
+	if publishing.MessageId == "" {
+		publishing.MessageId = uuid.New().String()
+	}
+	publishing.Timestamp = e.Timestamp
+	if publishing.Timestamp.IsZero() {
+		publishing.Timestamp = time.Now()
+	}
+	if e.Type != "" {
+		publishing.Type = e.Type
+	}
+	if e.Source != "" {
+		publishing.AppId = e.Source
+	}
+	publishing.CorrelationId = e.CorrelationID
+}
+
+// AddEventSubscription works like AddTypedSubscription, but the handler receives the Event envelope
+// with the decoded message as payload.
+func (s *Session) AddEventSubscription(exchangeName, queueName, routingKey string, newMessage func() interface{}, handler EventSubscriber) error {
+	return s.addSubscription(exchangeName, queueName, routingKey, func(ctx context.Context, delivery amqp.Delivery) {
+		message, ok := s.decode(delivery, newMessage)
+		if !ok {
+			return
+		}
+		event := EventFromDelivery(delivery)
+		event.Payload = message
+		handler(ctx, delivery, event)
+	})
+}
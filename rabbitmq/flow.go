@@ -0,0 +1,156 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+var (
+	publishFlowPaused = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "amqp_publisher_flow_paused",
+		Help: "1 if the broker currently paused the publishes using channel.flow or connection.blocked, 0 otherwise",
+	})
+	registerFlowMetrics sync.Once
+)
+
+// publishChannel returns the channel which is shared by all publishes, it is opened on first use
+// and renewed after it has been closed. Flow notifications of the channel pause the publishes,
+// as do connection.blocked notifications of the producer connection, see connectionBlocked.
+// If confirm is set, the channel in confirm mode is returned together with its confirmTracker.
+// If publisher confirms are enabled for the session, all publishes use the channel in confirm mode.
+func (s *Session) publishChannel(confirm bool) (*amqp.Channel, *confirmTracker, error) {
+	s.publishMutex.Lock()
+	defer s.publishMutex.Unlock()
+
+	confirm = confirm || s.opts.PublisherConfirms
+	if !confirm && s.publishCh != nil {
+		return s.publishCh, nil, nil
+	}
+	if confirm && s.confirmCh != nil {
+		return s.confirmCh, s.confirms, nil
+	}
+
+	ch, err := s.produceConn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+	var confirms *confirmTracker
+	if confirm {
+		if confirms, err = newConfirmTracker(ch); err != nil {
+			_ = ch.Close()
+			return nil, nil, err
+		}
+	}
+	registerFlowMetrics.Do(func() {
+		prometheus.MustRegister(publishFlowPaused)
+	})
+
+	if confirm {
+		s.confirmCh, s.confirms = ch, confirms
+	} else {
+		s.publishCh = ch
+	}
+	go s.watchPublishChannel(ch, ch.NotifyFlow(make(chan bool, 1)), ch.NotifyClose(make(chan *amqp.Error, 1)))
+	return ch, confirms, nil
+}
+
+// watchPublishChannel tracks the flow state of the channel until it is closed
+func (s *Session) watchPublishChannel(ch *amqp.Channel, flow <-chan bool, closed <-chan *amqp.Error) {
+	for {
+		select {
+		case active, ok := <-flow:
+			if !ok {
+				flow = nil
+				continue
+			}
+			s.setFlow(active)
+		case err, ok := <-closed:
+			s.publishMutex.Lock()
+			if s.publishCh == ch {
+				s.publishCh = nil
+			}
+			if s.confirmCh == ch {
+				s.confirmCh, s.confirms = nil, nil
+			}
+			s.publishMutex.Unlock()
+			s.setFlow(true)
+
+			if ok && err != nil {
+				s.logger.Warn("amqp publish channel error",
+					zap.String("err.reason", err.Reason),
+					zap.Int("err.code", err.Code))
+				s.channelError(err)
+			}
+			return
+		}
+	}
+}
+
+// setFlow pauses or resumes the publishes on behalf of channel.flow
+func (s *Session) setFlow(active bool) {
+	s.flowMutex.Lock()
+	defer s.flowMutex.Unlock()
+
+	s.flowPaused = !active
+	s.updateFlow()
+}
+
+// connectionBlocked pauses or resumes the publishes on behalf of connection.blocked
+func (s *Session) connectionBlocked(blocking amqp.Blocking) {
+	s.flowMutex.Lock()
+	defer s.flowMutex.Unlock()
+
+	if blocking.Active && !s.connBlocked {
+		s.logger.Warn("broker blocked the producer connection", zap.String("reason", blocking.Reason))
+	}
+	s.connBlocked = blocking.Active
+	s.updateFlow()
+}
+
+// updateFlow pauses the publishes while either the publish channel is paused or the producer connection
+// is blocked, and resumes them once neither is the case. The flowMutex must be held.
+func (s *Session) updateFlow() {
+	paused := s.flowPaused || s.connBlocked
+	if !paused && s.flowResumed != nil {
+		close(s.flowResumed)
+		s.flowResumed = nil
+		publishFlowPaused.Set(0)
+		s.logger.Info("broker resumed the publishes")
+	}
+	if paused && s.flowResumed == nil {
+		s.flowResumed = make(chan struct{})
+		publishFlowPaused.Set(1)
+		s.logger.Warn("broker paused the publishes, they block until they are resumed")
+	}
+}
+
+// waitForFlow blocks while the broker paused the publish channel. It gives up with ErrFlowPaused
+// after the publish timeout, so that callers do not buffer messages indefinitely.
+func (s *Session) waitForFlow() error {
+	s.flowMutex.Lock()
+	resumed := s.flowResumed
+	s.flowMutex.Unlock()
+	if resumed == nil {
+		return nil
+	}
+
+	var timeout <-chan time.Time
+	if s.opts.PublishTimeout > 0 {
+		timer := time.NewTimer(s.opts.PublishTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-s.ctx.Done():
+		return fmt.Errorf("session shut down while waiting for flow: %w", ErrSessionClosed)
+	case <-timeout:
+		return fmt.Errorf("publish channel was not resumed within %s: %w", s.opts.PublishTimeout, ErrFlowPaused)
+	}
+}
@@ -0,0 +1,56 @@
+package rabbitmq
+
+import (
+	"context"
+
+	"github.com/streadway/amqp"
+
+	"github.com/lukasjarosch/enki/idempotency"
+)
+
+// DefaultIdempotencyHeader is the header which carries the idempotency key of a message
+const DefaultIdempotencyHeader = "x-idempotency-key"
+
+// WithIdempotencyKey sets the idempotency key header of the message
+func WithIdempotencyKey(key string) PublishOption {
+	return func(publishing *amqp.Publishing) {
+		if publishing.Headers == nil {
+			publishing.Headers = amqp.Table{}
+		}
+		publishing.Headers[DefaultIdempotencyHeader] = key
+	}
+}
+
+// IdempotencyKey returns the idempotency key header of the delivery, or an empty string
+func IdempotencyKey(delivery amqp.Delivery) string {
+	key, _ := delivery.Headers[DefaultIdempotencyHeader].(string)
+	return key
+}
+
+// Idempotent wraps the handler of a retry subscription so that deliveries whose idempotency key
+// has already been processed are ACKed without calling the handler. Deliveries without a key
+// are always handled. If the handler fails, the key is forgotten so that a redelivery is processed.
+//
+//	session.AddRetrySubscription(exchange, queue, key, rabbitmq.DefaultRetryPolicy(), rabbitmq.Idempotent(store, handler))
+func Idempotent(store idempotency.Store, handler RetrySubscriber) RetrySubscriber {
+	return func(ctx context.Context, delivery amqp.Delivery) error {
+		key := IdempotencyKey(delivery)
+		if key == "" {
+			return handler(ctx, delivery)
+		}
+
+		seen, err := store.Seen(ctx, key)
+		if err != nil {
+			return Transient(err)
+		}
+		if seen {
+			return nil
+		}
+
+		if err := handler(ctx, delivery); err != nil {
+			_ = store.Forget(ctx, key)
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,331 @@
+package rabbitmq
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// DispatchMode defines what happens with a delivery if the dispatch queue is full
+type DispatchMode int
+
+const (
+	// DispatchBlock stops reading deliveries until the queue has room again (backpressure).
+	// The prefetch count then limits the amount of deliveries held in memory.
+	DispatchBlock DispatchMode = iota
+	// DispatchDrop NACKs the delivery with requeue, so the broker redelivers it later
+	DispatchDrop
+)
+
+// DefaultMaxMessageSize matches the default max_message_size of RabbitMQ (128MiB)
+const DefaultMaxMessageSize = 128 * 1024 * 1024
+
+// DefaultPrefetchCount is the default amount of unacknowledged deliveries per consumer
+const DefaultPrefetchCount = 10
+
+// DefaultPublishTimeout is the default time after which a blocked publish is aborted
+const DefaultPublishTimeout = 10 * time.Second
+
+// SessionOptions holds the optional settings of a Session
+type SessionOptions struct {
+	// Codecs maps the content type of incoming deliveries to the codec used to decode them
+	Codecs map[string]Codec
+	// DefaultCodec is used to decode deliveries without a content type
+	DefaultCodec Codec
+	// ServiceName is used as app-id of published messages, it defaults to the name of the binary
+	ServiceName string
+	// Codec encodes published messages
+	Codec Codec
+	// ContentType overrides the content type returned by the codec on all published messages
+	ContentType string
+	// DispatchBufferSize is the size of the queue between the consumer and the handlers
+	DispatchBufferSize int
+	// DispatchMode defines the behaviour if the dispatch queue is full
+	DispatchMode DispatchMode
+	// Concurrency is the amount of workers which handle deliveries concurrently
+	Concurrency int
+	// DispatchResolution defines which handlers receive a delivery matching multiple subscriptions
+	DispatchResolution DispatchResolution
+	// DeadlineHeader is the name of the header which carries the deadline of a delivery
+	DeadlineHeader string
+	// RequeueOnError requeues deliveries whose SubscriberFunc returned an error
+	RequeueOnError bool
+	// AckBatchSize is the amount of acks which are collected into a single multi-ack, 0 disables batching
+	AckBatchSize int
+	// AckFlushInterval is the interval in which collected acks are sent, regardless of the batch size
+	AckFlushInterval time.Duration
+	// PrefetchCount is the amount of unacknowledged deliveries the broker sends to the consumer
+	PrefetchCount int
+	// PrefetchSize is the amount of unacknowledged bytes the broker sends to the consumer, 0 means unlimited
+	PrefetchSize int
+	// QosGlobal applies the prefetch limit to the whole channel instead of every consumer
+	QosGlobal bool
+	// MaxMessageSize is the maximum size of a message body in bytes, 0 disables the check
+	MaxMessageSize int
+	// PublishTimeout bounds the time a single publish may take, 0 disables the timeout
+	PublishTimeout time.Duration
+	// PublishBufferSize is the amount of messages which are buffered while the producer connection is offline
+	PublishBufferSize int
+	// PublisherConfirms puts the publish channel into confirm mode
+	PublisherConfirms bool
+	// MaxInFlightConfirms limits the amount of unconfirmed publishes, 0 does not limit them
+	MaxInFlightConfirms int
+	// ConfirmTimeout bounds the time a confirmed publish waits for the confirmation, 0 disables the timeout
+	ConfirmTimeout time.Duration
+	// Backpressure configures when consuming is paused, nil disables it
+	Backpressure *Backpressure
+	// ConsumerAddress and ProducerAddress override the address of the session for the respective connection
+	ConsumerAddress string
+	ProducerAddress string
+	// ConsumerConnectionOptions are applied to the consumer connection
+	ConsumerConnectionOptions []ConnectionOption
+	// ProducerConnectionOptions are applied to the producer connection
+	ProducerConnectionOptions []ConnectionOption
+}
+
+type SessionOption func(*SessionOptions)
+
+// WithCodec sets the codec which encodes published messages, it defaults to the ProtobufCodec.
+// The codec also decodes deliveries without a content type and, if it implements ContentTyper,
+// deliveries with its content type.
+func WithCodec(codec Codec) SessionOption {
+	return func(options *SessionOptions) {
+		options.Codec = codec
+		options.DefaultCodec = codec
+		if typed, ok := codec.(ContentTyper); ok {
+			options.Codecs[typed.ContentType()] = codec
+		}
+	}
+}
+
+// WithContentTypeCodec registers the codec which decodes deliveries with the given content type
+func WithContentTypeCodec(contentType string, codec Codec) SessionOption {
+	return func(options *SessionOptions) {
+		options.Codecs[contentType] = codec
+	}
+}
+
+// WithDefaultCodec sets the codec which decodes deliveries without a content type
+func WithDefaultCodec(codec Codec) SessionOption {
+	return func(options *SessionOptions) {
+		options.DefaultCodec = codec
+	}
+}
+
+// WithServiceName sets the name which is used as app-id of all published messages
+func WithServiceName(name string) SessionOption {
+	return func(options *SessionOptions) {
+		options.ServiceName = name
+	}
+}
+
+// WithDispatchBuffer sets the size of the queue between the amqp consumer and the handlers, it defaults to 0.
+func WithDispatchBuffer(size int) SessionOption {
+	return func(options *SessionOptions) {
+		options.DispatchBufferSize = size
+	}
+}
+
+// WithConcurrency sets the amount of workers which handle deliveries concurrently, it defaults to 1.
+// With more than one worker the order in which deliveries are handled is not guaranteed, the prefetch
+// count should be at least as high as the concurrency to keep all workers busy.
+func WithConcurrency(workers int) SessionOption {
+	return func(options *SessionOptions) {
+		options.Concurrency = workers
+	}
+}
+
+// WithDispatchMode sets the behaviour if the dispatch queue is full, it defaults to DispatchBlock.
+func WithDispatchMode(mode DispatchMode) SessionOption {
+	return func(options *SessionOptions) {
+		options.DispatchMode = mode
+	}
+}
+
+// WithContentType overrides the content type of published messages, by default the content type
+// returned by the codec is used. The content type must be a valid media type, otherwise
+// the session fails with ErrInvalidOption, see Session.Err.
+func WithContentType(contentType string) SessionOption {
+	return func(options *SessionOptions) {
+		options.ContentType = contentType
+	}
+}
+
+// WithDeadlineHeader sets the name of the header which carries the deadline of a message, it defaults to x-deadline.
+func WithDeadlineHeader(name string) SessionOption {
+	return func(options *SessionOptions) {
+		options.DeadlineHeader = name
+	}
+}
+
+// WithAckBatching collects the acks of the handlers and sends them as single multi-ack
+// once size acks are collected or the interval elapsed. Only deliveries up to the highest tag
+// for which all previous deliveries have been settled are acked. Nacks are sent immediately.
+// Batching is disabled by default.
+func WithAckBatching(size int, interval time.Duration) SessionOption {
+	return func(options *SessionOptions) {
+		options.AckBatchSize = size
+		options.AckFlushInterval = interval
+	}
+}
+
+// WithRequeueOnError defines whether deliveries are requeued if the SubscriberFunc returns an error.
+// By default they are NACKed without requeue, so they are dead-lettered or dropped.
+func WithRequeueOnError(requeue bool) SessionOption {
+	return func(options *SessionOptions) {
+		options.RequeueOnError = requeue
+	}
+}
+
+// WithGlobalQos applies the prefetch limit to all consumers on the channel instead of each consumer separately.
+func WithGlobalQos(global bool) SessionOption {
+	return func(options *SessionOptions) {
+		options.QosGlobal = global
+	}
+}
+
+// WithQoS sets the prefetch limits of the consumer, see amqp.Channel.Qos.
+// By default, DefaultPrefetchCount deliveries are prefetched for every consumer.
+// RabbitMQ does not implement prefetchSize and rejects any value other than 0.
+func WithQoS(prefetchCount, prefetchSize int, global bool) SessionOption {
+	return func(options *SessionOptions) {
+		options.PrefetchCount = prefetchCount
+		options.PrefetchSize = prefetchSize
+		options.QosGlobal = global
+	}
+}
+
+// WithMaxMessageSize sets the maximum body size in bytes of published messages, 0 disables the check.
+// It defaults to DefaultMaxMessageSize and should match the max_message_size of the broker.
+func WithMaxMessageSize(size int) SessionOption {
+	return func(options *SessionOptions) {
+		options.MaxMessageSize = size
+	}
+}
+
+// WithConsumerAddress connects the consumer to a different broker endpoint than the address of the session,
+// e.g. a read cluster or another vhost
+func WithConsumerAddress(addr string) SessionOption {
+	return func(options *SessionOptions) {
+		options.ConsumerAddress = addr
+	}
+}
+
+// WithProducerAddress connects the producer to a different broker endpoint than the address of the session,
+// e.g. a write cluster or another vhost
+func WithProducerAddress(addr string) SessionOption {
+	return func(options *SessionOptions) {
+		options.ProducerAddress = addr
+	}
+}
+
+// WithConsumerConnectionOptions sets the options of the consumer connection
+func WithConsumerConnectionOptions(options ...ConnectionOption) SessionOption {
+	return func(opts *SessionOptions) {
+		opts.ConsumerConnectionOptions = options
+	}
+}
+
+// WithProducerConnectionOptions sets the options of the producer connection
+func WithProducerConnectionOptions(options ...ConnectionOption) SessionOption {
+	return func(opts *SessionOptions) {
+		opts.ProducerConnectionOptions = options
+	}
+}
+
+// ConnectionOptions holds the optional settings of a Connection
+type ConnectionOptions struct {
+	// ReconnectDelay is the delay between two reconnection attempts
+	ReconnectDelay time.Duration
+	// SASL are the authentication mechanisms offered to the broker, PLAIN with the URI credentials if empty
+	SASL []amqp.Authentication
+	// TLSConfig is used for amqps connections
+	TLSConfig *tls.Config
+	// Heartbeat is the heartbeat interval negotiated with the broker, it defaults to DefaultHeartbeat
+	Heartbeat time.Duration
+	// Locale is the locale of the connection, it defaults to DefaultLocale
+	Locale string
+	// DialTimeout limits establishing the TCP connection and the AMQP handshake, it defaults to DefaultDialTimeout
+	DialTimeout time.Duration
+}
+
+type ConnectionOption func(*ConnectionOptions)
+
+// WithReconnectDelay sets the delay between two reconnection attempts, it defaults to ReconnectDelay.
+func WithReconnectDelay(delay time.Duration) ConnectionOption {
+	return func(options *ConnectionOptions) {
+		options.ReconnectDelay = delay
+	}
+}
+
+// WithHeartbeat sets the heartbeat interval which is negotiated with the broker, it defaults to DefaultHeartbeat.
+// A dead connection is detected after about two missed heartbeats and then reconnected.
+func WithHeartbeat(interval time.Duration) ConnectionOption {
+	return func(options *ConnectionOptions) {
+		options.Heartbeat = interval
+	}
+}
+
+// WithLocale sets the locale of the connection, it defaults to DefaultLocale.
+func WithLocale(locale string) ConnectionOption {
+	return func(options *ConnectionOptions) {
+		options.Locale = locale
+	}
+}
+
+// WithDialTimeout sets the timeout of establishing a connection, it defaults to DefaultDialTimeout.
+func WithDialTimeout(timeout time.Duration) ConnectionOption {
+	return func(options *ConnectionOptions) {
+		options.DialTimeout = timeout
+	}
+}
+
+// WithPublishTimeout sets the time after which a blocked publish is aborted with ErrPublishTimeout.
+// It defaults to DefaultPublishTimeout, 0 disables the timeout.
+// The aborted publish is not cancelled, it still reaches the broker once the channel is unblocked,
+// so retrying on ErrPublishTimeout may publish the message twice.
+func WithPublishTimeout(timeout time.Duration) SessionOption {
+	return func(options *SessionOptions) {
+		options.PublishTimeout = timeout
+	}
+}
+
+// WithPublishBuffer buffers up to size messages in memory while the producer connection is offline,
+// instead of failing the publish. The buffered messages are published in order once the connection has been
+// recovered and before Shutdown closes it. If the buffer is full, publishes fail with ErrPublishBufferFull.
+// Messages published with PublishConfirmed are never buffered.
+func WithPublishBuffer(size int) SessionOption {
+	return func(options *SessionOptions) {
+		options.PublishBufferSize = size
+	}
+}
+
+// WithBackpressure pauses reading deliveries while too many deliveries are in flight or the handlers are too slow.
+// Backpressure is disabled by default.
+func WithBackpressure(config Backpressure) SessionOption {
+	return func(options *SessionOptions) {
+		options.Backpressure = &config
+	}
+}
+
+// WithSASL sets the authentication mechanisms which are offered to the broker.
+// By default, PLAIN authentication with the credentials of the URI is used.
+func WithSASL(mechanisms ...amqp.Authentication) ConnectionOption {
+	return func(options *ConnectionOptions) {
+		options.SASL = mechanisms
+	}
+}
+
+// WithExternalAuth authenticates using the SASL EXTERNAL mechanism, the broker derives the identity
+// from the TLS client certificate. The client certificate is configured using WithTLSConfig.
+func WithExternalAuth() ConnectionOption {
+	return WithSASL(ExternalAuth{})
+}
+
+// WithTLSConfig sets the TLS configuration (e.g. root CAs and client certificates) of amqps connections
+func WithTLSConfig(config *tls.Config) ConnectionOption {
+	return func(options *ConnectionOptions) {
+		options.TLSConfig = config
+	}
+}
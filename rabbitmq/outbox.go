@@ -0,0 +1,155 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+var (
+	publishBuffered = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "amqp_publisher_buffered_messages_total",
+		Help: "Number of messages which have been buffered because the producer connection was offline",
+	})
+	publishBufferDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "amqp_publisher_buffer_dropped_messages_total",
+		Help: "Number of messages which have been dropped because the publish buffer was full",
+	})
+	registerBufferMetrics sync.Once
+)
+
+// bufferedPublishing is a message which waits in the publish buffer for the producer connection
+type bufferedPublishing struct {
+	exchange   string
+	routingKey string
+	publishing amqp.Publishing
+}
+
+// publishBuffer is the in-memory outbox of a session, see WithPublishBuffer.
+// Buffered messages are published in order, the head of the queue is only removed once it has been published.
+type publishBuffer struct {
+	mutex    sync.Mutex
+	size     int
+	queue    []bufferedPublishing
+	flush    sync.Mutex
+	flushing int32
+}
+
+func newPublishBuffer(size int) *publishBuffer {
+	registerBufferMetrics.Do(func() {
+		prometheus.MustRegister(publishBuffered, publishBufferDropped)
+	})
+	return &publishBuffer{size: size}
+}
+
+// push appends the message to the buffer, ErrPublishBufferFull is returned if the buffer is full
+func (b *publishBuffer) push(message bufferedPublishing) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.queue) >= b.size {
+		publishBufferDropped.Inc()
+		return fmt.Errorf("cannot buffer message for exchange %s (%d messages): %w",
+			message.exchange, b.size, ErrPublishBufferFull)
+	}
+	b.queue = append(b.queue, message)
+	publishBuffered.Inc()
+	return nil
+}
+
+// head returns the oldest buffered message
+func (b *publishBuffer) head() (bufferedPublishing, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.queue) == 0 {
+		return bufferedPublishing{}, false
+	}
+	return b.queue[0], true
+}
+
+// pop removes the oldest buffered message after it has been published
+func (b *publishBuffer) pop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.queue[0] = bufferedPublishing{}
+	b.queue = b.queue[1:]
+}
+
+// len returns the amount of buffered messages
+func (b *publishBuffer) len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.queue)
+}
+
+// offline reports whether a publish failed because the producer connection is down
+func offline(err error) bool {
+	return errors.Is(err, ErrNotConnected) || errors.Is(err, amqp.ErrClosed)
+}
+
+// bufferPublishing puts the message into the publish buffer, it is published once the producer connection is back
+func (s *Session) bufferPublishing(exchange, routingKey string, publishing amqp.Publishing) error {
+	err := s.buffer.push(bufferedPublishing{
+		exchange:   exchange,
+		routingKey: routingKey,
+		publishing: publishing,
+	})
+	if err != nil {
+		s.logger.Error("publish buffer is full, dropping message",
+			zap.String("exchange", exchange),
+			zap.String("routingKey", routingKey))
+		return err
+	}
+	s.logger.Warn("producer connection offline, buffered message",
+		zap.String("exchange", exchange),
+		zap.String("routingKey", routingKey))
+
+	if s.produceConn != nil && s.produceConn.IsConnected() {
+		go s.triggerFlush()
+	}
+	return nil
+}
+
+// triggerFlush flushes the publish buffer unless a flush is running already
+func (s *Session) triggerFlush() {
+	if !atomic.CompareAndSwapInt32(&s.buffer.flushing, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&s.buffer.flushing, 0)
+	_ = s.flushPublishBuffer()
+}
+
+// flushPublishBuffer publishes the buffered messages in order. It stops at the first message which
+// cannot be published, that message stays at the head of the buffer until the next flush.
+func (s *Session) flushPublishBuffer() error {
+	s.buffer.flush.Lock()
+	defer s.buffer.flush.Unlock()
+
+	flushed := 0
+	for {
+		message, ok := s.buffer.head()
+		if !ok {
+			break
+		}
+		if err := s.send(message.exchange, message.routingKey, false, message.publishing); err != nil {
+			s.logger.Warn("failed to flush publish buffer",
+				zap.Int("flushed", flushed),
+				zap.Int("buffered", s.buffer.len()),
+				zap.Error(err))
+			return err
+		}
+		s.buffer.pop()
+		flushed++
+	}
+	if flushed > 0 {
+		s.logger.Info("publish buffer flushed", zap.Int("flushed", flushed))
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Package rabbitmqtest provides an in-memory fake of the rabbitmq session which can be used
+// to exercise publishers and subscribers in unit tests without a broker.
+package rabbitmqtest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+
+	"github.com/lukasjarosch/enki/rabbitmq"
+)
+
+// Acknowledgement records how a handler acknowledged a delivery
+type Acknowledgement struct {
+	Acked    bool
+	Nacked   bool
+	Rejected bool
+	Requeue  bool
+	Multiple bool
+}
+
+// Handled returns true if the delivery has been acked, nacked or rejected
+func (a *Acknowledgement) Handled() bool {
+	return a.Acked || a.Nacked || a.Rejected
+}
+
+// Session is an in-memory fake which implements the publish and subscribe surface of rabbitmq.Session.
+// Published messages are recorded and delivered synchronously to the subscriber of the routing key.
+type Session struct {
+	mutex       sync.Mutex
+	codec       rabbitmq.Codec
+	subscribers map[string]rabbitmq.Subscriber
+	published   []amqp.Publishing
+	deliveryTag uint64
+}
+
+var _ rabbitmq.Publisher = &Session{}
+
+// NewSession returns a fake session which encodes messages using the ProtobufCodec
+func NewSession() *Session {
+	return NewSessionWithCodec(rabbitmq.ProtobufCodec{})
+}
+
+// NewSessionWithCodec returns a fake session which encodes messages using the codec
+func NewSessionWithCodec(codec rabbitmq.Codec) *Session {
+	return &Session{
+		codec:       codec,
+		subscribers: make(map[string]rabbitmq.Subscriber),
+	}
+}
+
+// AddSubscription registers the handler for the routing key, the exchange and queue are ignored.
+func (s *Session) AddSubscription(exchangeName, queueName, routingKey string, handler rabbitmq.Subscriber) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.subscribers[routingKey]; exists {
+		return fmt.Errorf("a subscriber with routingKey %s is already registered", routingKey)
+	}
+	s.subscribers[routingKey] = handler
+	return nil
+}
+
+// Publish records the message and delivers it to the subscriber of the routing key, if there is one.
+func (s *Session) Publish(routingKey string, event interface{}, options ...rabbitmq.PublishOption) error {
+	body, contentType, err := s.codec.Marshal(event)
+	if err != nil {
+		return err
+	}
+	publishing := amqp.Publishing{
+		ContentType: contentType,
+		Timestamp:   time.Now(),
+		Body:        body,
+	}
+	for _, opt := range options {
+		opt(&publishing)
+	}
+
+	s.mutex.Lock()
+	s.published = append(s.published, publishing)
+	s.mutex.Unlock()
+
+	s.deliver(routingKey, publishing)
+	return nil
+}
+
+// Deliver encodes the event and passes it to the subscriber of the routing key.
+// The returned Acknowledgement records how the handler acknowledged the delivery.
+func (s *Session) Deliver(routingKey string, event interface{}) (*Acknowledgement, error) {
+	body, contentType, err := s.codec.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return s.deliver(routingKey, amqp.Publishing{ContentType: contentType, Body: body}), nil
+}
+
+// Published returns all messages which have been published so far
+func (s *Session) Published() []amqp.Publishing {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	published := make([]amqp.Publishing, len(s.published))
+	copy(published, s.published)
+	return published
+}
+
+// deliver converts the publishing into a delivery and calls the subscriber.
+// A delivery without subscriber is nacked, just like the real session does.
+func (s *Session) deliver(routingKey string, publishing amqp.Publishing) *Acknowledgement {
+	s.mutex.Lock()
+	s.deliveryTag++
+	tag := s.deliveryTag
+	handler, ok := s.subscribers[routingKey]
+	s.mutex.Unlock()
+
+	ack := &Acknowledgement{}
+	delivery := amqp.Delivery{
+		Acknowledger:  &acknowledger{ack: ack},
+		Headers:       publishing.Headers,
+		ContentType:   publishing.ContentType,
+		CorrelationId: publishing.CorrelationId,
+		MessageId:     publishing.MessageId,
+		Timestamp:     publishing.Timestamp,
+		Type:          publishing.Type,
+		AppId:         publishing.AppId,
+		DeliveryTag:   tag,
+		RoutingKey:    routingKey,
+		Body:          publishing.Body,
+	}
+
+	if !ok {
+		_ = delivery.Nack(false, false)
+		return ack
+	}
+	handler(delivery)
+	return ack
+}
+
+// acknowledger implements amqp.Acknowledger and records the calls
+type acknowledger struct {
+	mutex sync.Mutex
+	ack   *Acknowledgement
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.ack.Acked = true
+	a.ack.Multiple = multiple
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.ack.Nacked = true
+	a.ack.Multiple = multiple
+	a.ack.Requeue = requeue
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.ack.Rejected = true
+	a.ack.Requeue = requeue
+	return nil
+}
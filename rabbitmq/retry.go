@@ -0,0 +1,120 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+// DefaultDeliveryCountHeader is the header in which quorum queues count the redeliveries of a message
+const DefaultDeliveryCountHeader = "x-delivery-count"
+
+// DefaultMaxRequeues is the requeue cap of the DefaultRetryPolicy
+const DefaultMaxRequeues = 3
+
+// RetryPolicy decides how a delivery is settled based on the outcome of a RetrySubscriber.
+// A nil error ACKs the delivery. A transient error requeues the delivery until it has been delivered
+// MaxRequeues times, all other errors NACK the delivery without requeue so that it is dead-lettered
+// (if the queue has a dead-letter exchange) or dropped.
+//
+// The requeue cap relies on the delivery count header which is maintained by quorum queues.
+// Classic queues do not count redeliveries, so a redelivered message without the header is treated
+// as if the cap has been reached: it is requeued at most once, a transient error on the redelivery
+// NACKs it without requeue. Note that the broker also flags deliveries as redelivered after a
+// consumer or connection failure. Use quorum queues if MaxRequeues should be honored exactly.
+type RetryPolicy struct {
+	// MaxRequeues is the number of times a delivery is requeued on transient errors, 0 disables requeueing
+	MaxRequeues int
+	// IsTransient classifies handler errors, it defaults to errors.Is(err, ErrTransient)
+	IsTransient func(err error) bool
+	// DeliveryCountHeader defaults to DefaultDeliveryCountHeader
+	DeliveryCountHeader string
+}
+
+// DefaultRetryPolicy requeues transient errors up to DefaultMaxRequeues times
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRequeues: DefaultMaxRequeues,
+	}
+}
+
+// transient reports whether err should be retried
+func (p RetryPolicy) transient(err error) bool {
+	if p.IsTransient != nil {
+		return p.IsTransient(err)
+	}
+	return errors.Is(err, ErrTransient)
+}
+
+// deliveryCount returns how often the delivery has been requeued already. Without the delivery count header,
+// a redelivered message counts as MaxRequeues, the number of previous requeues is unknown.
+func (p RetryPolicy) deliveryCount(delivery amqp.Delivery) int {
+	header := p.DeliveryCountHeader
+	if header == "" {
+		header = DefaultDeliveryCountHeader
+	}
+	switch count := delivery.Headers[header].(type) {
+	case int64:
+		return int(count)
+	case int32:
+		return int(count)
+	case int:
+		return count
+	}
+	if delivery.Redelivered {
+		return p.MaxRequeues
+	}
+	return 0
+}
+
+// AddRetrySubscription adds a subscription whose handler reports its outcome as error.
+// The delivery is settled according to the given RetryPolicy, the handler must not ACK or NACK it.
+func (s *Session) AddRetrySubscription(exchangeName, queueName, routingKey string, policy RetryPolicy, handler RetrySubscriber) error {
+	return s.addSubscription(exchangeName, queueName, routingKey, func(ctx context.Context, delivery amqp.Delivery) {
+		s.settle(policy, delivery, handler(ctx, delivery))
+	})
+}
+
+// AddSubscriptionFunc adds a subscription whose handler reports its outcome as error.
+// A nil error ACKs the delivery, any other error NACKs it, with requeue if WithRequeueOnError is set.
+// The handler must not ACK or NACK the delivery, use AddSubscription if it settles deliveries itself.
+func (s *Session) AddSubscriptionFunc(exchangeName, queueName, routingKey string, handler SubscriberFunc) error {
+	return s.addSubscription(exchangeName, queueName, routingKey, func(ctx context.Context, delivery amqp.Delivery) {
+		err := handler(delivery)
+		if err == nil {
+			_ = delivery.Ack(false)
+			return
+		}
+		s.logger.Error("handler failed, NACKing delivery",
+			zap.String("routingKey", delivery.RoutingKey),
+			zap.Bool("requeue", s.opts.RequeueOnError),
+			zap.Error(err))
+		_ = delivery.Nack(false, s.opts.RequeueOnError)
+	})
+}
+
+// settle ACKs or NACKs the delivery according to the policy and the handler error
+func (s *Session) settle(policy RetryPolicy, delivery amqp.Delivery, err error) {
+	if err == nil {
+		_ = delivery.Ack(false)
+		return
+	}
+
+	count := policy.deliveryCount(delivery)
+	if policy.transient(err) && count < policy.MaxRequeues {
+		s.logger.Warn("handler failed with transient error, requeueing delivery",
+			zap.String("routingKey", delivery.RoutingKey),
+			zap.Int("deliveryCount", count),
+			zap.Error(err))
+		_ = delivery.Nack(false, true)
+		return
+	}
+
+	s.logger.Error("handler failed, NACKing delivery without requeue",
+		zap.String("routingKey", delivery.RoutingKey),
+		zap.Int("deliveryCount", count),
+		zap.Error(err))
+	_ = delivery.Nack(false, false)
+}
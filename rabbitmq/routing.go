@@ -0,0 +1,144 @@
+package rabbitmq
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// DispatchResolution defines which handlers receive a delivery if the routing key matches
+// multiple subscriptions, e.g. a catch-all '#' subscription next to specific routing keys.
+type DispatchResolution int
+
+const (
+	// ResolveExact dispatches to a single handler: an exact routing key match wins, otherwise the most
+	// specific wildcard subscription (the one with the most literal words) receives the delivery.
+	// Ties are resolved in the order in which the subscriptions were added. This is the default.
+	ResolveExact DispatchResolution = iota
+	// ResolveFanOut dispatches to all matching handlers. The delivery is ACKed once every handler ACKed it,
+	// if any handler NACKs or rejects it, the delivery is NACKed after all handlers settled it, with
+	// requeue if any of them requested it. Handlers must therefore be idempotent.
+	ResolveFanOut
+)
+
+// WithDispatchResolution defines which handlers receive a delivery matching multiple subscriptions
+func WithDispatchResolution(resolution DispatchResolution) SessionOption {
+	return func(options *SessionOptions) {
+		options.DispatchResolution = resolution
+	}
+}
+
+// resolve returns the handlers of the queue which should receive a delivery with the given routing key
+func (c *queueConsumer) resolve(routingKey string, resolution DispatchResolution) []ContextSubscriber {
+	if handler, ok := c.subscribers[routingKey]; ok && resolution == ResolveExact {
+		return []ContextSubscriber{handler}
+	}
+
+	var handlers []ContextSubscriber
+	best := -1
+	seen := make(map[string]bool)
+	for _, subscription := range c.subscriptions {
+		pattern := subscription.RoutingKey
+		if seen[pattern] || !topicMatch(pattern, routingKey) {
+			continue
+		}
+		seen[pattern] = true
+
+		if resolution == ResolveFanOut {
+			handlers = append(handlers, c.subscribers[pattern])
+			continue
+		}
+		if literals := literalWords(pattern); literals > best {
+			best = literals
+			handlers = []ContextSubscriber{c.subscribers[pattern]}
+		}
+	}
+	return handlers
+}
+
+// topicMatch reports whether the routing key matches the binding pattern of a topic exchange.
+// '*' matches exactly one word, '#' matches zero or more words.
+func topicMatch(pattern, routingKey string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func matchWords(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if matchWords(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchWords(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && matchWords(pattern[1:], words[1:])
+	}
+}
+
+// literalWords counts the words of the pattern which are not wildcards
+func literalWords(pattern string) int {
+	count := 0
+	for _, word := range strings.Split(pattern, ".") {
+		if word != "*" && word != "#" {
+			count++
+		}
+	}
+	return count
+}
+
+// fanOutAcknowledger settles a delivery which has been dispatched to multiple handlers
+// only once, after all handlers have settled it.
+type fanOutAcknowledger struct {
+	acknowledger amqp.Acknowledger
+	mutex        sync.Mutex
+	pending      int
+	failed       bool
+	requeue      bool
+}
+
+// fanOut returns the delivery with an acknowledger which is shared by the n handlers
+func fanOut(delivery amqp.Delivery, n int) amqp.Delivery {
+	delivery.Acknowledger = &fanOutAcknowledger{
+		acknowledger: delivery.Acknowledger,
+		pending:      n,
+	}
+	return delivery
+}
+
+func (f *fanOutAcknowledger) Ack(tag uint64, multiple bool) error {
+	return f.settle(tag, false, false)
+}
+
+func (f *fanOutAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	return f.settle(tag, true, requeue)
+}
+
+func (f *fanOutAcknowledger) Reject(tag uint64, requeue bool) error {
+	return f.settle(tag, true, requeue)
+}
+
+func (f *fanOutAcknowledger) settle(tag uint64, failed, requeue bool) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.pending == 0 {
+		return nil
+	}
+	f.pending--
+	f.failed = f.failed || failed
+	f.requeue = f.requeue || requeue
+	if f.pending > 0 {
+		return nil
+	}
+	if f.failed {
+		return f.acknowledger.Nack(tag, false, f.requeue)
+	}
+	return f.acknowledger.Ack(tag, false)
+}
@@ -3,62 +3,214 @@ package rabbitmq
 import (
 	"context"
 	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/google/uuid"
+	"github.com/lukasjarosch/enki/recovery"
 	"github.com/streadway/amqp"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
 type Publisher interface {
-	Publish(routingKey string, event interface{}) error
+	Publish(routingKey string, event interface{}, options ...PublishOption) error
+}
+
+// PublishOption modifies the amqp.Publishing of a single message before it is sent
+type PublishOption func(*amqp.Publishing)
+
+// WithMessageAppID overrides the app-id property, which defaults to the service name of the session
+func WithMessageAppID(appID string) PublishOption {
+	return func(publishing *amqp.Publishing) {
+		publishing.AppId = appID
+	}
+}
+
+// WithMessageType overrides the type property, which defaults to the full name of the proto message
+func WithMessageType(messageType string) PublishOption {
+	return func(publishing *amqp.Publishing) {
+		publishing.Type = messageType
+	}
 }
 
 type PublishExchange string
 
+// SubscriptionInfo describes a subscription which has been added to a session
+type SubscriptionInfo struct {
+	Exchange   string
+	Queue      string
+	RoutingKey string
+}
+
+// PublisherInfo describes a publisher which has been added to a session
+type PublisherInfo struct {
+	Exchange   string
+	RoutingKey string
+}
+
 type Session struct {
-	addr          string
-	ctx           context.Context
-	cancel        context.CancelFunc
-	logger        *zap.Logger
-	subscribers   map[string]Subscriber
-	publishers    map[string]PublishExchange
-	consumerQueue string
-	consumeConn   *Connection
-	produceConn   *Connection
-	consumerDecls []Declaration
-	producerDecls []Declaration
-}
-
-func NewSession(addr string, logger *zap.Logger) *Session {
+	opts             *SessionOptions
+	addr             string
+	ctx              context.Context
+	cancel           context.CancelFunc
+	logger           *zap.Logger
+	queues           []*queueConsumer
+	subscriptions    []SubscriptionInfo
+	publishers       map[string]PublishExchange
+	consumeConn      *Connection
+	produceConn      *Connection
+	produceConnMutex sync.Mutex
+	consumerDecls    []Declaration
+	producerDecls    []Declaration
+	consumerTag      string
+	handlerMutex     sync.Mutex
+	connErrorHandler func(*amqp.Error)
+	chanErrorHandler func(*amqp.Error)
+	declared         bool
+	consumers        sync.WaitGroup
+	done             chan struct{}
+	doneOnce         sync.Once
+	publishMutex     sync.Mutex
+	publishCh        *amqp.Channel
+	flowMutex        sync.Mutex
+	flowResumed      chan struct{}
+	flowPaused       bool
+	connBlocked      bool
+	confirmCh        *amqp.Channel
+	confirms         *confirmTracker
+	confirmSlots     chan struct{}
+	buffer           *publishBuffer
+	optionsErr       error
+}
+
+// NewSession creates a session which connects to addr once it is used.
+// Invalid options, e.g. a content type which is not a valid media type, are reported by Err,
+// Declare and every publish.
+func NewSession(addr string, logger *zap.Logger, options ...SessionOption) *Session {
+	args := &SessionOptions{
+		Codecs: map[string]Codec{
+			ContentTypeOctetStream: ProtobufCodec{},
+			ContentTypeProtobuf:    ProtobufCodec{},
+			ContentTypeJSON:        JSONCodec{},
+		},
+		Codec:          ProtobufCodec{},
+		DefaultCodec:   ProtobufCodec{},
+		ServiceName:    filepath.Base(os.Args[0]),
+		DeadlineHeader: DefaultDeadlineHeader,
+		MaxMessageSize: DefaultMaxMessageSize,
+		PublishTimeout: DefaultPublishTimeout,
+		PrefetchCount:  DefaultPrefetchCount,
+		Concurrency:    1,
+		ConfirmTimeout: DefaultConfirmTimeout,
+	}
+
+	for _, opt := range options {
+		opt(args)
+	}
+	if args.Concurrency < 1 {
+		args.Concurrency = 1
+	}
+	var optionsErr error
+	if args.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(args.ContentType); err != nil {
+			optionsErr = fmt.Errorf("content type %q: %s: %w", args.ContentType, err, ErrInvalidOption)
+			logger.Error("invalid session option", zap.Error(optionsErr))
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	s := &Session{
-		addr:          addr,
-		ctx:           ctx,
-		cancel:        cancel,
-		logger:        logger,
-		subscribers:   make(map[string]Subscriber),
-		publishers:    make(map[string]PublishExchange),
-		consumerQueue: "",
+		opts:        args,
+		addr:        addr,
+		ctx:         ctx,
+		cancel:      cancel,
+		logger:      logger,
+		publishers:  make(map[string]PublishExchange),
+		consumerTag: fmt.Sprintf("enki-%s", uuid.New().String()),
+		optionsErr:  optionsErr,
+	}
+	if args.PublisherConfirms && args.MaxInFlightConfirms > 0 {
+		s.confirmSlots = make(chan struct{}, args.MaxInFlightConfirms)
+	}
+	if args.PublishBufferSize > 0 {
+		s.buffer = newPublishBuffer(args.PublishBufferSize)
 	}
 
 	return s
 }
 
+// Err returns the error of an invalid SessionOption passed to NewSession, nil if all options are valid
+func (s *Session) Err() error {
+	return s.optionsErr
+}
+
 // AddSubscription is a wrapper which uses the Auto*() functions
 // to quickly add an exchange, queue and binding to the declarations list.
 // It will also register the subscriber handler function with the subscriber map.
+// Subscriptions cannot be added after Declare() has been called, an error is returned in that case.
 // If no connection for the consumer exist, the connection is established
 // at this point. This happens only once, even if you add multiple subscriptions.
 func (s *Session) AddSubscription(exchangeName, queueName, routingKey string, handler Subscriber) error {
-	if s.consumerQueue != "" && s.consumerQueue != queueName {
-		return fmt.Errorf("a consumer queue with name '%s' has already been defined", s.consumerQueue)
+	return s.addSubscription(exchangeName, queueName, routingKey, func(ctx context.Context, delivery amqp.Delivery) {
+		handler(delivery)
+	})
+}
+
+// AddContextSubscription works like AddSubscription, but the handler also receives a context.
+// The context is cancelled when the session shuts down and carries the deadline of the delivery, if any.
+func (s *Session) AddContextSubscription(exchangeName, queueName, routingKey string, handler ContextSubscriber) error {
+	return s.addSubscription(exchangeName, queueName, routingKey, handler)
+}
+
+func (s *Session) addSubscription(exchangeName, queueName, routingKey string, handler ContextSubscriber) error {
+	return s.addQueueSubscription(exchangeName, queueName, routingKey, AutoQueue(queueName), handler)
+}
+
+// AddSubscriptionWithDLX works like AddSubscription, but the queue is declared with a dead-letter exchange.
+// Deliveries which are NACKed without requeue, e.g. because of an unknown routing key, are routed to
+// the dead-letter exchange and end up in the dead-letter queue '<queue>.dlq' for later inspection.
+// The dead-letter exchange and queue are declared automatically.
+// All subscriptions of a queue must agree on the dead-letter exchange, the broker rejects
+// redeclaring a queue with different arguments.
+func (s *Session) AddSubscriptionWithDLX(exchangeName, queueName, routingKey, dlxExchange string, handler Subscriber) error {
+	if err := s.addQueueSubscription(exchangeName, queueName, routingKey, AutoQueueWithDLX(queueName, dlxExchange, ""), func(ctx context.Context, delivery amqp.Delivery) {
+		handler(delivery)
+	}); err != nil {
+		return err
+	}
+	s.consumerDecls = append(s.consumerDecls, AutoDeadLetter(dlxExchange, queueName))
+	return nil
+}
+
+// addQueueSubscription registers the handler and the declarations of the subscription, the queue is
+// declared by the given declaration. Routing keys are scoped to their queue, the same routing key
+// can be subscribed with different handlers on different queues.
+func (s *Session) addQueueSubscription(exchangeName, queueName, routingKey string, queue Declaration, handler ContextSubscriber) error {
+	if s.declared {
+		return fmt.Errorf("subscriptions must be added before Declare() is called")
+	}
+	consumer := s.queue(queueName)
+	if consumer == nil {
+		consumer = newQueueConsumer(queueName, fmt.Sprintf("%s-%s", s.consumerTag, queueName))
+		s.queues = append(s.queues, consumer)
 	}
-	s.consumerQueue = queueName
 	s.consumerDecls = append(s.consumerDecls, AutoExchange(exchangeName))
-	s.consumerDecls = append(s.consumerDecls, AutoQueue(queueName))
+	s.consumerDecls = append(s.consumerDecls, queue)
 	s.consumerDecls = append(s.consumerDecls, AutoBinding(routingKey, queueName, exchangeName))
-	s.subscribers[routingKey] = handler
+	subscription := SubscriptionInfo{
+		Exchange:   exchangeName,
+		Queue:      queueName,
+		RoutingKey: routingKey,
+	}
+	consumer.subscribe(subscription, handler)
+	s.subscriptions = append(s.subscriptions, subscription)
 
 	s.logger.Info("added subscription",
 		zap.String("exchange", exchangeName),
@@ -67,6 +219,51 @@ func (s *Session) AddSubscription(exchangeName, queueName, routingKey string, ha
 	return nil
 }
 
+// AddTypedSubscription works like AddSubscription, but the delivery body is decoded before the handler is called.
+// The codec is selected by the content type of the delivery, deliveries without content type are
+// decoded using the default codec. newMessage must return a pointer to a new, empty message of the expected type.
+// Deliveries with an unknown content type or an undecodable body are NACKed without requeue, so they
+// end up in the dead-letter exchange if one is configured.
+func (s *Session) AddTypedSubscription(exchangeName, queueName, routingKey string, newMessage func() interface{}, handler TypedSubscriber) error {
+	return s.addSubscription(exchangeName, queueName, routingKey, s.decodingSubscriber(newMessage, handler))
+}
+
+// decodingSubscriber wraps a TypedSubscriber into a ContextSubscriber which decodes the delivery first
+func (s *Session) decodingSubscriber(newMessage func() interface{}, handler TypedSubscriber) ContextSubscriber {
+	return func(ctx context.Context, delivery amqp.Delivery) {
+		if message, ok := s.decode(delivery, newMessage); ok {
+			handler(delivery, message)
+		}
+	}
+}
+
+// decode unmarshals the body of the delivery into a new message using the codec of its content type.
+// If the delivery cannot be decoded, it is NACKed without requeue and false is returned.
+func (s *Session) decode(delivery amqp.Delivery, newMessage func() interface{}) (interface{}, bool) {
+	codec := s.opts.DefaultCodec
+	if delivery.ContentType != "" {
+		var ok bool
+		if codec, ok = s.opts.Codecs[delivery.ContentType]; !ok {
+			s.logger.Error("delivery has unknown content type, NACKing",
+				zap.String("contentType", delivery.ContentType),
+				zap.String("routingKey", delivery.RoutingKey))
+			_ = delivery.Nack(false, false)
+			return nil, false
+		}
+	}
+
+	message := newMessage()
+	if err := codec.Unmarshal(delivery.Body, message); err != nil {
+		s.logger.Error("failed to decode delivery, NACKing",
+			zap.String("contentType", delivery.ContentType),
+			zap.String("routingKey", delivery.RoutingKey),
+			zap.Error(err))
+		_ = delivery.Nack(false, false)
+		return nil, false
+	}
+	return message, true
+}
+
 // AddPublisher is a wrapper to convenitently prepare the session for publishing on a specific exchange.
 // The method ensures that the target exchange is declared when calling Declare().
 func (s *Session) AddPublisher(exchangeName, routingKey string) error {
@@ -79,73 +276,256 @@ func (s *Session) AddPublisher(exchangeName, routingKey string) error {
 	return nil
 }
 
+// AddPublisherWithAlternateExchange works like AddPublisher, but declares the exchange with an
+// alternate exchange which captures all messages that cannot be routed to any queue.
+func (s *Session) AddPublisherWithAlternateExchange(exchangeName, routingKey, alternateExchange string) error {
+	if _, exists := s.publishers[routingKey]; exists {
+		return fmt.Errorf("a publisher with that routingKey is already registered")
+	}
+	s.producerDecls = append(s.producerDecls, AutoExchangeWithAlternate(exchangeName, alternateExchange))
+	s.publishers[routingKey] = PublishExchange(exchangeName)
+
+	return nil
+}
+
+// Subscriptions returns all subscriptions in the order they have been added
+func (s *Session) Subscriptions() []SubscriptionInfo {
+	subscriptions := make([]SubscriptionInfo, len(s.subscriptions))
+	copy(subscriptions, s.subscriptions)
+	return subscriptions
+}
+
+// Publishers returns all registered publishers, sorted by routing key
+func (s *Session) Publishers() []PublisherInfo {
+	var publishers []PublisherInfo
+	for routingKey, exchange := range s.publishers {
+		publishers = append(publishers, PublisherInfo{
+			Exchange:   string(exchange),
+			RoutingKey: routingKey,
+		})
+	}
+	sort.Slice(publishers, func(i, j int) bool {
+		return publishers[i].RoutingKey < publishers[j].RoutingKey
+	})
+	return publishers
+}
+
 // Publish will take the event, marshall it into a proto.Message and then send it on it's journey
 // to the spe
-func (s *Session) Publish(routingKey string, event interface{}) error {
+func (s *Session) Publish(routingKey string, event interface{}, options ...PublishOption) error {
+	exchange, ok := s.publishers[routingKey]
+	if !ok {
+		return fmt.Errorf("no publisher with routingKey %s registered, cannot resolve exchange: %w", routingKey, ErrUnknownRoutingKey)
+	}
+
+	return s.publish(string(exchange), routingKey, event, false, options...)
+}
+
+// PublishConfirmed works like Publish, but waits until the broker confirmed the message, even if publisher
+// confirms are not enabled for the session. ErrPublishNacked is returned if the broker rejected the message
+// and ErrConfirmTimeout if no confirmation arrived within the confirm timeout, in both cases the message
+// may be published again.
+func (s *Session) PublishConfirmed(routingKey string, event interface{}, options ...PublishOption) error {
 	exchange, ok := s.publishers[routingKey]
 	if !ok {
-		return fmt.Errorf("no publisher with routingKey %s registered, cannot resolve exchange", routingKey)
+		return fmt.Errorf("no publisher with routingKey %s registered, cannot resolve exchange: %w", routingKey, ErrUnknownRoutingKey)
 	}
 
-	protobuf := event.(proto.Message)
-	bodyBytes, err := proto.Marshal(protobuf)
+	return s.publish(string(exchange), routingKey, event, true, options...)
+}
+
+// PublishTo sends the event directly to the given exchange, without the need to register a publisher first.
+// The exchange is expected to exist already, it is not declared by the session.
+func (s *Session) PublishTo(exchange, routingKey string, event interface{}, options ...PublishOption) error {
+	return s.publish(exchange, routingKey, event, false, options...)
+}
+
+// publish marshals the event and sends it to the exchange using the producer connection
+func (s *Session) publish(exchange, routingKey string, event interface{}, confirm bool, options ...PublishOption) error {
+	if s.optionsErr != nil {
+		return s.optionsErr
+	}
+	var envelope *Event
+	switch e := event.(type) {
+	case Event:
+		envelope, event = &e, e.Payload
+	case *Event:
+		envelope, event = e, e.Payload
+	}
+
+	bodyBytes, contentType, err := s.opts.Codec.Marshal(event)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %s", ErrMarshal, err)
+	}
+	if s.opts.ContentType != "" {
+		contentType = s.opts.ContentType
+	}
+	if s.opts.MaxMessageSize > 0 && len(bodyBytes) > s.opts.MaxMessageSize {
+		return fmt.Errorf("cannot publish %d bytes to exchange %s (max %d bytes): %w",
+			len(bodyBytes), exchange, s.opts.MaxMessageSize, ErrMessageTooLarge)
 	}
 	publishing := amqp.Publishing{
 		Headers:      amqp.Table{},
-		ContentType:  "application/octet-stream",
+		ContentType:  contentType,
 		DeliveryMode: amqp.Transient,
 		Priority:     0,
+		AppId:        s.opts.ServiceName,
 		Body:         bodyBytes,
 	}
+	if message, ok := event.(proto.Message); ok {
+		publishing.Type = proto.MessageName(message)
+	}
+	if envelope != nil {
+		envelope.apply(&publishing)
+	}
+	for _, opt := range options {
+		opt(&publishing)
+	}
 
-	ch, err := s.produceConn.Channel()
-	if err != nil {
+	// confirmed publishes are never buffered, the caller waits for the broker
+	buffered := s.buffer != nil && !confirm
+	if err := s.ensureProducerConnection(); err != nil {
+		if buffered && offline(err) {
+			return s.bufferPublishing(exchange, routingKey, publishing)
+		}
 		return err
 	}
-
-	if err := ch.Publish(string(exchange), routingKey, false, false, publishing); err != nil {
+	if buffered && s.buffer.len() > 0 {
+		return s.bufferPublishing(exchange, routingKey, publishing)
+	}
+	err = s.send(exchange, routingKey, confirm, publishing)
+	if buffered && offline(err) {
+		return s.bufferPublishing(exchange, routingKey, publishing)
+	}
+	if err != nil {
 		return err
 	}
 
 	s.logger.Info(fmt.Sprintf("published message to exchange %s with routingKey %s", exchange, routingKey),
-		zap.String("exchange", string(exchange)),
+		zap.String("exchange", exchange),
 		zap.String("routingKey", routingKey))
 
 	return nil
 }
 
+// send publishes the message on the publish channel
+func (s *Session) send(exchange, routingKey string, confirm bool, publishing amqp.Publishing) error {
+	ch, confirms, err := s.publishChannel(confirm)
+	if err != nil {
+		return err
+	}
+	if err := s.waitForFlow(); err != nil {
+		return err
+	}
+
+	if confirms != nil {
+		return s.publishConfirmed(ch, confirms, exchange, routingKey, publishing)
+	}
+	return s.publishWithTimeout(ch, exchange, routingKey, publishing)
+}
+
+// publishWithTimeout publishes on the channel, but gives up after the publish timeout elapsed.
+// A publish can block forever if the connection is blocked by the broker or the socket buffer is full.
+func (s *Session) publishWithTimeout(ch *amqp.Channel, exchange, routingKey string, publishing amqp.Publishing) error {
+	return s.withPublishTimeout(exchange, func() error {
+		return ch.Publish(exchange, routingKey, false, false, publishing)
+	})
+}
+
+// withPublishTimeout calls the publish func, but gives up after the publish timeout elapsed
+func (s *Session) withPublishTimeout(exchange string, publish func() error) error {
+	if s.opts.PublishTimeout <= 0 {
+		return publish()
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- publish()
+	}()
+
+	timer := time.NewTimer(s.opts.PublishTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("publish to exchange %s did not complete within %s: %w",
+			exchange, s.opts.PublishTimeout, ErrPublishTimeout)
+	}
+}
+
 // ensureConnections will ensure that for any configured consumer or producer declarations,
 // a connection exists and is online.
 func (s *Session) ensureConnections() error {
 	if len(s.consumerDecls) > 0 && s.consumeConn == nil {
-		s.consumeConn = NewConnection(s.addr, s.logger.Named("consumer"))
+		s.consumeConn = NewConnection(s.connectionAddress(s.opts.ConsumerAddress), s.logger.Named("consumer"), s.opts.ConsumerConnectionOptions...)
+		s.consumeConn.OnError(s.connectionError)
 		if err := s.consumeConn.Connect(); err != nil {
-			return fmt.Errorf("failed to create amqp connection: %s", err)
+			return fmt.Errorf("failed to create amqp connection: %s: %w", err, ErrNotConnected)
 		}
 		s.logger.Info("amqp consumer connection established")
 	}
-	if len(s.producerDecls) > 0 && s.produceConn == nil {
-		s.produceConn = NewConnection(s.addr, s.logger.Named("producer"))
-		if err := s.produceConn.Connect(); err != nil {
-			return fmt.Errorf("failed to create amqp connection: %s", err)
+	if len(s.producerDecls) > 0 {
+		if err := s.ensureProducerConnection(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectionAddress returns the address of a connection, it falls back to the address of the session
+func (s *Session) connectionAddress(addr string) string {
+	if addr != "" {
+		return addr
+	}
+	return s.addr
+}
+
+// ensureProducerConnection establishes the producer connection if it does not exist yet.
+// It is also used by PublishTo which does not require any producer declarations.
+func (s *Session) ensureProducerConnection() error {
+	s.produceConnMutex.Lock()
+	defer s.produceConnMutex.Unlock()
+
+	if s.produceConn != nil {
+		return nil
+	}
+
+	conn := NewConnection(s.connectionAddress(s.opts.ProducerAddress), s.logger.Named("producer"), s.opts.ProducerConnectionOptions...)
+	conn.OnError(s.connectionError)
+	conn.OnBlocked(s.connectionBlocked)
+	if s.buffer != nil {
+		conn.OnReconnect(s.triggerFlush)
+	}
+	if err := conn.Connect(); err != nil {
+		// with a publish buffer, publishes are buffered until the broker is reachable for the first time
+		if s.buffer != nil {
+			s.produceConn = conn
+			conn.ConnectInBackground()
 		}
-		s.logger.Info("amqp producer connection established")
+		return fmt.Errorf("failed to create amqp connection: %s: %w", err, ErrNotConnected)
 	}
+	s.produceConn = conn
+	s.logger.Info("amqp producer connection established")
 	return nil
 }
 
 // Declare goes through all declarations and uses the consumer/produce connection to
 // obtain a channel and perform the declarations.
 func (s *Session) Declare() error {
+	if s.optionsErr != nil {
+		return s.optionsErr
+	}
 	if err := s.ensureConnections(); err != nil {
 		return err
 	}
 
 	// declare all the subscriber things!
 	if len(s.consumerDecls) > 0 {
-		ch, _ := s.consumeConn.Channel()
+		ch, err := s.consumeConn.Channel()
+		if err != nil {
+			return fmt.Errorf("failed to open channel for consumer declarations: %w", err)
+		}
 		for _, declare := range s.consumerDecls {
 			if err := declare(ch); err != nil {
 				return fmt.Errorf("failed to declare for consumer: %s", err.Error())
@@ -155,7 +535,10 @@ func (s *Session) Declare() error {
 
 	// declare all the consumer things!
 	if len(s.producerDecls) > 0 {
-		ch, _ := s.produceConn.Channel()
+		ch, err := s.produceConn.Channel()
+		if err != nil {
+			return fmt.Errorf("failed to open channel for producer declarations: %w", err)
+		}
 		for _, declare := range s.producerDecls {
 			if err := declare(ch); err != nil {
 				return fmt.Errorf("failed to declare for producer: %s", err.Error())
@@ -163,25 +546,162 @@ func (s *Session) Declare() error {
 		}
 	}
 
+	s.declared = true
 	return nil
 }
 
+// OnConnectionError registers a handler which is called whenever one of the session connections
+// is closed with an error. The handler runs in its own goroutine.
+func (s *Session) OnConnectionError(handler func(*amqp.Error)) {
+	s.handlerMutex.Lock()
+	defer s.handlerMutex.Unlock()
+	s.connErrorHandler = handler
+}
+
+// OnChannelError registers a handler which is called whenever the consumer channel is closed with an error
+// or publishing fails with an amqp error. The handler runs in its own goroutine.
+func (s *Session) OnChannelError(handler func(*amqp.Error)) {
+	s.handlerMutex.Lock()
+	defer s.handlerMutex.Unlock()
+	s.chanErrorHandler = handler
+}
+
+func (s *Session) connectionError(err *amqp.Error) {
+	s.handlerMutex.Lock()
+	handler := s.connErrorHandler
+	s.handlerMutex.Unlock()
+
+	if handler != nil {
+		handler(err)
+	}
+}
+
+func (s *Session) channelError(err *amqp.Error) {
+	s.handlerMutex.Lock()
+	handler := s.chanErrorHandler
+	s.handlerMutex.Unlock()
+
+	if handler != nil {
+		go handler(err)
+	}
+}
+
+// watchChannel reports the error the channel is closed with to the channel error handler
+func (s *Session) watchChannel(ch *amqp.Channel) {
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		if err, ok := <-closed; ok && err != nil {
+			s.logger.Warn("amqp channel error",
+				zap.String("err.reason", err.Reason),
+				zap.Int("err.code", err.Code))
+			s.channelError(err)
+		}
+	}()
+}
+
+// WaitReady blocks until all connections required by the declarations are connected or the context expires.
+// Declare must have been called before.
+func (s *Session) WaitReady(ctx context.Context) error {
+	var required []*Connection
+	if len(s.consumerDecls) > 0 {
+		required = append(required, s.consumeConn)
+	}
+	if len(s.producerDecls) > 0 {
+		required = append(required, s.produceConn)
+	}
+	for _, conn := range required {
+		if conn == nil {
+			return fmt.Errorf("amqp connections have not been established, Declare must be called first: %w", ErrNotConnected)
+		}
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		ready := true
+		for _, conn := range required {
+			ready = ready && conn.IsConnected()
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("amqp session not ready: %s", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
 // Shutdown all existing connections but wait for any in-flight messages to be processed first.
 // Finally, the session context is cancelled which will stop any child-goroutines.
 func (s *Session) Shutdown() {
 	defer s.cancel()
 
 	if s.consumeConn != nil {
+		if err := s.Drain(); err != nil {
+			s.logger.Warn("failed to drain consumer, in-flight deliveries may be redelivered", zap.Error(err))
+		}
 		s.consumeConn.Shutdown()
 		s.logger.Info("amqp consumer connection closed")
 	}
+	if s.buffer != nil && s.buffer.len() > 0 {
+		if err := s.flushPublishBuffer(); err != nil {
+			s.logger.Error("buffered messages are lost", zap.Int("buffered", s.buffer.len()), zap.Error(err))
+		}
+	}
 	if s.produceConn != nil {
 		s.produceConn.Shutdown()
 		s.logger.Info("amqp producer connection closed")
 	}
 }
 
+// Done returns a channel which is closed once the session has been shut down and all of its goroutines,
+// the consume loop including the running handlers and the reconnect monitors, have exited.
+func (s *Session) Done() <-chan struct{} {
+	s.doneOnce.Do(func() {
+		s.done = make(chan struct{})
+		go func() {
+			<-s.ctx.Done()
+			s.consumers.Wait()
+			if s.consumeConn != nil {
+				s.consumeConn.Wait()
+			}
+			if s.produceConn != nil {
+				s.produceConn.Wait()
+			}
+			close(s.done)
+		}()
+	})
+	return s.done
+}
+
+// Wait blocks until the session is done, see Done
+func (s *Session) Wait() {
+	<-s.Done()
+}
+
+// Consume consumes from all queues of the subscriptions until the session is shut down.
+// Every queue is consumed in its own goroutine on its own channel, Consume blocks until all of them returned.
 func (s *Session) Consume() {
+	var queues sync.WaitGroup
+	for _, consumer := range s.queues {
+		queues.Add(1)
+		go func(consumer *queueConsumer) {
+			defer queues.Done()
+			s.consume(consumer)
+		}(consumer)
+	}
+	queues.Wait()
+}
+
+// consume runs the consume loop of a single queue, the channel is renewed whenever it is lost
+func (s *Session) consume(consumer *queueConsumer) {
+	s.consumers.Add(1)
+	defer s.consumers.Done()
+
+	logger := s.logger.With(zap.String("queue", consumer.queue))
 	for {
 		select {
 		case <-s.ctx.Done():
@@ -189,35 +709,261 @@ func (s *Session) Consume() {
 		default:
 		}
 
+		if resume := consumer.pausedUntil(); resume != nil {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-resume:
+				logger.Info("consuming resumed")
+			}
+			continue
+		}
+
 		if !s.consumeConn.IsConnected() {
-			s.logger.Info("consuming halted: connection offline")
+			logger.Info("consuming halted: connection offline")
 			time.Sleep(5 * time.Second)
 			continue
 		}
 
 		ch, err := s.consumeConn.Channel()
 		if err != nil {
-			s.logger.Error("failed to fetch channel", zap.Error(err))
+			logger.Error("failed to fetch channel", zap.Error(err))
 			continue
 		}
 
-		_ = ch.Qos(10, 0, false)
+		if err := ch.Qos(s.opts.PrefetchCount, s.opts.PrefetchSize, s.opts.QosGlobal); err != nil {
+			logger.Error("failed to set qos", zap.Error(err))
+			_ = ch.Close()
+			time.Sleep(5 * time.Second)
+			continue
+		}
 
-		deliveries, err := ch.Consume(s.consumerQueue, "", false, false, false, false, nil)
+		deliveries, err := ch.Consume(consumer.queue, consumer.tag, false, false, false, false, nil)
 		if err != nil {
-			s.logger.Error("consumer error", zap.Error(err))
+			logger.Error("consumer error", zap.Error(err))
 			continue
 		}
+		s.watchChannel(ch)
+		logger.Info("consuming started",
+			zap.Int("prefetchCount", s.opts.PrefetchCount),
+			zap.Int("prefetchSize", s.opts.PrefetchSize),
+			zap.Bool("global", s.opts.QosGlobal),
+			zap.Int("concurrency", s.opts.Concurrency))
+		stopped := consumer.start(ch)
+		s.dispatch(consumer, deliveries)
+		consumer.stop(stopped)
+	}
+}
+
+// dispatch passes the deliveries through the dispatch queue to the workers which handle them.
+// It returns once the deliveries channel is closed and all queued deliveries have been handled.
+func (s *Session) dispatch(consumer *queueConsumer, deliveries <-chan amqp.Delivery) {
+	queue := make(chan amqp.Delivery, s.opts.DispatchBufferSize)
 
-		for delivery := range deliveries {
-			routingKey := delivery.RoutingKey
-			s.logger.Info("incoming amqp delivery", zap.String("routingKey", routingKey))
-			if handler, ok := s.subscribers[routingKey]; ok {
-				handler(delivery)
-			} else {
-				s.logger.Error("delivery has routing key which cannot be processed, NACKing")
-				_ = delivery.Nack(false, false)
+	var batcher *ackBatcher
+	if s.opts.AckBatchSize > 0 {
+		batcher = newAckBatcher(s.logger, s.opts.AckBatchSize, s.opts.AckFlushInterval)
+	}
+
+	var pressure *backpressure
+	if s.opts.Backpressure != nil {
+		pressure = newBackpressure(s.logger.With(zap.String("queue", consumer.queue)), consumer.queue, *s.opts.Backpressure)
+	}
+
+	var workers sync.WaitGroup
+	workers.Add(s.opts.Concurrency)
+	for i := 0; i < s.opts.Concurrency; i++ {
+		go func() {
+			defer workers.Done()
+			for delivery := range queue {
+				start := time.Now()
+				s.handle(consumer, delivery)
+				if pressure != nil {
+					pressure.release(time.Since(start))
+				}
+			}
+		}()
+	}
+
+	for delivery := range deliveries {
+		if batcher != nil {
+			delivery = batcher.wrap(delivery)
+		}
+		if pressure != nil && !pressure.acquire(s.ctx) {
+			_ = delivery.Nack(false, true)
+			continue
+		}
+		if s.opts.DispatchMode == DispatchDrop {
+			select {
+			case queue <- delivery:
+			default:
+				s.logger.Warn("dispatch queue is full, NACKing delivery for redelivery",
+					zap.String("routingKey", delivery.RoutingKey))
+				_ = delivery.Nack(false, true)
+				if pressure != nil {
+					pressure.abort()
+				}
 			}
+			continue
+		}
+		queue <- delivery
+	}
+
+	close(queue)
+	workers.Wait()
+	if batcher != nil {
+		batcher.Close()
+	}
+}
+
+// handle passes the delivery to the subscriber of its routing key on the queue
+func (s *Session) handle(consumer *queueConsumer, delivery amqp.Delivery) {
+	routingKey := delivery.RoutingKey
+	s.logger.Info("incoming amqp delivery", zap.String("routingKey", routingKey), zap.String("queue", consumer.queue))
+	handlers := consumer.resolve(routingKey, s.opts.DispatchResolution)
+	if len(handlers) == 0 {
+		s.logger.Error("delivery has routing key which cannot be processed, NACKing",
+			zap.String("routingKey", routingKey),
+			zap.String("queue", consumer.queue))
+		_ = delivery.Nack(false, false)
+		return
+	}
+
+	ctx := s.ctx
+	if deadline, ok := s.deliveryDeadline(delivery); ok {
+		if time.Now().After(deadline) {
+			s.logger.Warn("delivery has expired, NACKing",
+				zap.String("routingKey", routingKey),
+				zap.Time("deadline", deadline))
+			_ = delivery.Nack(false, false)
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	span, ctx := startConsumeSpan(ctx, delivery)
+	defer span.Finish()
+
+	if len(handlers) > 1 {
+		delivery = fanOut(delivery, len(handlers))
+	}
+	for _, handler := range handlers {
+		s.invoke(ctx, handler, delivery)
+	}
+}
+
+// invoke calls the handler and recovers from panics, so that a failing handler does not stop the consumer.
+// The delivery of a panicking handler is NACKed without requeue unless the handler already settled it.
+func (s *Session) invoke(ctx context.Context, handler ContextSubscriber, delivery amqp.Delivery) {
+	settled := &settleOnceAcknowledger{acknowledger: delivery.Acknowledger}
+	delivery.Acknowledger = settled
+	defer func() {
+		if p := recover(); p != nil {
+			recovery.Log(s.logger, p, recovery.TransportAMQP,
+				zap.String("routingKey", delivery.RoutingKey),
+				zap.String("messageId", delivery.MessageId))
+			_ = delivery.Nack(false, false)
+		}
+	}()
+	handler(ctx, delivery)
+}
+
+// settleOnceAcknowledger forwards only the first settlement of a delivery, settling a delivery twice
+// is a protocol error which closes the channel.
+type settleOnceAcknowledger struct {
+	acknowledger amqp.Acknowledger
+	settled      int32
+}
+
+func (o *settleOnceAcknowledger) Ack(tag uint64, multiple bool) error {
+	if !atomic.CompareAndSwapInt32(&o.settled, 0, 1) {
+		return nil
+	}
+	return o.acknowledger.Ack(tag, multiple)
+}
+
+func (o *settleOnceAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	if !atomic.CompareAndSwapInt32(&o.settled, 0, 1) {
+		return nil
+	}
+	return o.acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (o *settleOnceAcknowledger) Reject(tag uint64, requeue bool) error {
+	if !atomic.CompareAndSwapInt32(&o.settled, 0, 1) {
+		return nil
+	}
+	return o.acknowledger.Reject(tag, requeue)
+}
+
+// Drain stops consuming from all queues without closing any connection. The consumers are cancelled on the
+// broker and Drain blocks until all deliveries which have already been received are handled.
+// The publisher is not affected. Use Resume to start consuming again.
+func (s *Session) Drain() error {
+	var errs error
+	for _, consumer := range s.queues {
+		errs = multierr.Append(errs, s.drain(consumer))
+	}
+	return errs
+}
+
+// drain cancels the consumer of the queue and waits until its deliveries have been handled
+func (s *Session) drain(consumer *queueConsumer) error {
+	ch, stopped := consumer.pause()
+	if ch == nil {
+		s.logger.Info("consumer drained", zap.String("queue", consumer.queue))
+		return nil
+	}
+
+	if err := ch.Cancel(consumer.tag, false); err != nil {
+		return fmt.Errorf("failed to cancel consumer of queue %s: %s", consumer.queue, err)
+	}
+	select {
+	case <-stopped:
+	case <-s.ctx.Done():
+	}
+	s.logger.Info("consumer drained", zap.String("queue", consumer.queue))
+	return nil
+}
+
+// Resume starts consuming from all queues again after the session has been drained.
+// Queues paused with PauseSubscription are resumed as well.
+func (s *Session) Resume() {
+	for _, consumer := range s.queues {
+		consumer.unpause()
+	}
+}
+
+// PauseSubscription stops consuming from the queue: only the consumer of that queue is cancelled on the broker
+// and PauseSubscription blocks until the handlers of the deliveries already received from it have finished.
+// The other queues of the session keep consuming, unlike with Drain. The queue stays paused across reconnects
+// until ResumeSubscription or Resume is called. ErrUnknownQueue is returned if no subscription consumes from the queue.
+func (s *Session) PauseSubscription(queueName string) error {
+	consumer := s.queue(queueName)
+	if consumer == nil {
+		return fmt.Errorf("cannot pause queue %s: %w", queueName, ErrUnknownQueue)
+	}
+	return s.drain(consumer)
+}
+
+// ResumeSubscription starts consuming from a paused queue again
+func (s *Session) ResumeSubscription(queueName string) error {
+	consumer := s.queue(queueName)
+	if consumer == nil {
+		return fmt.Errorf("cannot resume queue %s: %w", queueName, ErrUnknownQueue)
+	}
+	consumer.unpause()
+	return nil
+}
+
+// queue returns the consumer of the queue, nil if no subscription consumes from it
+func (s *Session) queue(name string) *queueConsumer {
+	for _, consumer := range s.queues {
+		if consumer.queue == name {
+			return consumer
 		}
 	}
+	return nil
 }
@@ -0,0 +1,58 @@
+package rabbitmq
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/streadway/amqp"
+
+	"github.com/lukasjarosch/enki/trace"
+)
+
+// WithTraceContext propagates the span and the baggage items of the context through the message headers.
+// The consuming session continues the trace and restores the baggage into the handler context.
+func WithTraceContext(ctx context.Context) PublishOption {
+	return func(publishing *amqp.Publishing) {
+		if publishing.Headers == nil {
+			publishing.Headers = amqp.Table{}
+		}
+		carrier := headersCarrier(publishing.Headers)
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			_ = opentracing.GlobalTracer().Inject(span.Context(), opentracing.TextMap, carrier)
+		}
+		trace.InjectBaggage(ctx, carrier)
+	}
+}
+
+// startConsumeSpan continues the trace of the delivery, if any, and restores its baggage items.
+// The returned span must be finished once the delivery has been handled.
+func startConsumeSpan(ctx context.Context, delivery amqp.Delivery) (opentracing.Span, context.Context) {
+	carrier := headersCarrier(delivery.Headers)
+	var opts []opentracing.StartSpanOption
+	if spanContext, err := opentracing.GlobalTracer().Extract(opentracing.TextMap, carrier); err == nil {
+		opts = append(opts, opentracing.FollowsFrom(spanContext))
+	}
+	opts = append(opts, ext.SpanKindConsumer, opentracing.Tag{Key: "amqp.routing_key", Value: delivery.RoutingKey})
+
+	span, ctx := opentracing.StartSpanFromContext(ctx, "amqp consume "+delivery.RoutingKey, opts...)
+	return span, trace.ExtractBaggage(ctx, carrier)
+}
+
+// headersCarrier implements the opentracing TextMap carrier for amqp headers, non-string headers are skipped
+type headersCarrier amqp.Table
+
+func (c headersCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headersCarrier) ForeachKey(handler func(key, value string) error) error {
+	for key, value := range c {
+		if s, ok := value.(string); ok {
+			if err := handler(key, s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package rabbitmq
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/streadway/amqp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/lukasjarosch/enki/interceptor"
+	"github.com/lukasjarosch/enki/trace"
+)
+
+func TestHeadersCarrierRoundTrip(t *testing.T) {
+	ctx := trace.SetBaggageItem(context.Background(), "tenant", "acme")
+
+	headers := amqp.Table{"x-retry-count": int32(1)}
+	trace.InjectBaggage(ctx, headersCarrier(headers))
+
+	extracted := trace.ExtractBaggage(context.Background(), headersCarrier(headers))
+	if value := trace.BaggageItem(extracted, "tenant"); value != "acme" {
+		t.Errorf("expected baggage item tenant=acme, got %q", value)
+	}
+	if _, ok := headers["x-retry-count"]; !ok {
+		t.Error("expected the non-string header to be kept")
+	}
+}
+
+func TestBaggagePropagatesAcrossDeliveries(t *testing.T) {
+	const hops = 3
+
+	ctx := trace.SetBaggageItem(context.Background(), "tenant", "acme")
+	for i := 0; i < hops; i++ {
+		publishing := amqp.Publishing{}
+		WithTraceContext(ctx)(&publishing)
+
+		var span opentracing.Span
+		span, ctx = startConsumeSpan(context.Background(), amqp.Delivery{
+			Headers:    publishing.Headers,
+			RoutingKey: "test.hop",
+		})
+		span.Finish()
+
+		if value := trace.BaggageItem(ctx, "tenant"); value != "acme" {
+			t.Errorf("hop %d: expected baggage item tenant=acme, got %q", i, value)
+		}
+	}
+}
+
+// checkServer is a health server which runs the handler for every check
+type checkServer func(ctx context.Context) error
+
+func (f checkServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if err := f(ctx); err != nil {
+		return nil, err
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func (f checkServer) Watch(*grpc_health_v1.HealthCheckRequest, grpc_health_v1.Health_WatchServer) error {
+	return nil
+}
+
+// startGrpcHop serves srv with the baggage interceptors over an in-memory listener and returns a client
+// connected to it, the returned func stops the server and closes the client connection
+func startGrpcHop(t *testing.T, srv grpc_health_v1.HealthServer) (grpc_health_v1.HealthClient, func()) {
+	t.Helper()
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.UnaryInterceptor(interceptor.Baggage()))
+	grpc_health_v1.RegisterHealthServer(server, srv)
+	go server.Serve(listener)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(interceptor.BaggageClient()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+	)
+	if err != nil {
+		server.Stop()
+		t.Fatalf("failed to dial bufconn: %v", err)
+	}
+
+	return grpc_health_v1.NewHealthClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+// TestBaggagePropagatesAcrossGrpcAndAmqp follows a baggage item from the edge through a gRPC hop,
+// an AMQP publish and delivery and another gRPC hop
+func TestBaggagePropagatesAcrossGrpcAndAmqp(t *testing.T) {
+	observed := make(chan string, 1)
+	last, stopLast := startGrpcHop(t, checkServer(func(ctx context.Context) error {
+		observed <- trace.BaggageItem(ctx, "tenant")
+		return nil
+	}))
+	defer stopLast()
+
+	// the consumer of the AMQP hop calls the last gRPC hop
+	consume := func(delivery amqp.Delivery) error {
+		span, ctx := startConsumeSpan(context.Background(), delivery)
+		defer span.Finish()
+		_, err := last.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		return err
+	}
+
+	// the first gRPC hop publishes the message which is delivered to the consumer
+	first, stopFirst := startGrpcHop(t, checkServer(func(ctx context.Context) error {
+		publishing := amqp.Publishing{}
+		WithTraceContext(ctx)(&publishing)
+		return consume(amqp.Delivery{Headers: publishing.Headers, RoutingKey: "test.hop"})
+	}))
+	defer stopFirst()
+
+	ctx := trace.SetBaggageItem(context.Background(), "tenant", "acme")
+	if _, err := first.Check(ctx, &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+
+	if value := <-observed; value != "acme" {
+		t.Errorf("expected baggage item tenant=acme at the last hop, got %q", value)
+	}
+}
@@ -0,0 +1,50 @@
+package recovery
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"go.uber.org/zap"
+)
+
+// Transports which are passed to Log, they end up in the 'transport' field of the panic log
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+	TransportAMQP = "amqp"
+)
+
+// Field keys of the panic log schema, the request is described with the keys of the logging package
+const (
+	FieldPanic     = "panic"
+	FieldStack     = "stacktrace"
+	FieldTransport = "transport"
+)
+
+// Panic carries a recovered panic value together with the stack trace of the goroutine which panicked.
+// It is used to re-raise a panic in another goroutine without losing the panic location, see Log.
+type Panic struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *Panic) String() string {
+	return fmt.Sprint(p.Value)
+}
+
+// Log logs a recovered panic value together with the stack trace of the panicking goroutine.
+// It must be called from the deferred function which recovered the panic, otherwise the stack trace
+// does not contain the panic location. If the value is a *Panic, its value and stack trace are logged instead.
+// The fields describe the request, e.g. method and request-id, using the keys of the logging package
+// so that panic logs look the same on every transport.
+func Log(logger *zap.Logger, value interface{}, transport string, fields ...zap.Field) {
+	stack := debug.Stack()
+	if p, ok := value.(*Panic); ok {
+		value, stack = p.Value, p.Stack
+	}
+	logger.Error("recovered from panic", append([]zap.Field{
+		zap.Any(FieldPanic, value),
+		zap.ByteString(FieldStack, stack),
+		zap.String(FieldTransport, transport),
+	}, fields...)...)
+}
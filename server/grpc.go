@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -9,13 +10,18 @@ import (
 	"time"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware"
-	grpcrecovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	grpcopentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
 	grpcprometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
+	"golang.org/x/net/netutil"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 
 	"github.com/lukasjarosch/enki/interceptor"
 )
@@ -24,6 +30,29 @@ import (
 type GrpcConfig struct {
 	Port        string        `mapstructure:"grpc-port"`
 	GracePeriod time.Duration `mapstructure:"grpc-grace-period"`
+	// MaxConnections limits the amount of simultaneously accepted connections, 0 means unlimited.
+	// Connections exceeding the limit are not accepted until an existing connection is closed.
+	MaxConnections int `mapstructure:"grpc-max-connections"`
+	// TLSCertFile and TLSKeyFile enable TLS, the server speaks plaintext h2c if they are empty
+	TLSCertFile string `mapstructure:"grpc-tls-cert-file"`
+	TLSKeyFile  string `mapstructure:"grpc-tls-key-file"`
+	// TLSClientCAFile enables mutual TLS, clients must present a certificate signed by one of its CAs
+	TLSClientCAFile string `mapstructure:"grpc-tls-client-ca-file"`
+	// MaxConnectionIdle, MaxConnectionAge, KeepaliveTime and KeepaliveTimeout are the keepalive.ServerParameters,
+	// zero values keep the gRPC defaults. A MaxConnectionAge below the idle timeout of a load balancer
+	// makes clients reconnect before the balancer silently drops their connection.
+	MaxConnectionIdle     time.Duration `mapstructure:"grpc-max-connection-idle"`
+	MaxConnectionAge      time.Duration `mapstructure:"grpc-max-connection-age"`
+	MaxConnectionAgeGrace time.Duration `mapstructure:"grpc-max-connection-age-grace"`
+	KeepaliveTime         time.Duration `mapstructure:"grpc-keepalive-time"`
+	KeepaliveTimeout      time.Duration `mapstructure:"grpc-keepalive-timeout"`
+	// KeepaliveMinTime and KeepalivePermitWithoutStream are the keepalive.EnforcementPolicy for client pings,
+	// the policy is only applied if one of them is set
+	KeepaliveMinTime             time.Duration `mapstructure:"grpc-keepalive-min-time"`
+	KeepalivePermitWithoutStream bool          `mapstructure:"grpc-keepalive-permit-without-stream"`
+	// Reflection registers the server reflection service for tools like grpcurl.
+	// It exposes the schema of all services and should not be enabled in production.
+	Reflection bool `mapstructure:"grpc-reflection"`
 }
 
 // GrpcServer defines the default behaviour of gRPC servers
@@ -31,9 +60,14 @@ type GrpcServer struct {
 	GoogleGrpc      *grpc.Server
 	logger          *zap.Logger
 	config          *GrpcConfig
+	opts            *GrpcOptions
 	listener        net.Listener
-	healthy         bool
+	health          *health.Server
 	requestDuration prometheus.Histogram
+	inFlight        *prometheus.GaugeVec
+	requestSize     *prometheus.HistogramVec
+	responseSize    *prometheus.HistogramVec
+	metrics         *grpcprometheus.ServerMetrics
 }
 
 // NewGrpcServer returns a new, pre-initialized, GrpcServer instance
@@ -41,37 +75,222 @@ type GrpcServer struct {
 // If the application does not terminate, the port is open and a raw gRPC server has been created after
 // the call of NewGrpcServer()
 // 'tracer' may be nil, in this case the feature is disabled
-func NewGrpcServer(logger *zap.Logger, config *GrpcConfig) *GrpcServer {
+func NewGrpcServer(logger *zap.Logger, config *GrpcConfig, options ...GrpcOption) *GrpcServer {
+	args := &GrpcOptions{
+		RecoveryMode: interceptor.RecoveryModeError,
+	}
+
+	for _, opt := range options {
+		opt(args)
+	}
+
 	srv := &GrpcServer{
 		logger: logger.Named("grpc"),
 		config: config,
+		opts:   args,
 	}
 
+	srv.registerMetrics()
 	srv.setupGrpc()
 
 	return srv
 }
 
+// registerMetrics registers the in-flight request gauge and the message size histograms.
+// The number of goroutines is already exported as go_goroutines by the default Go collector.
+func (srv *GrpcServer) registerMetrics() {
+	srv.inFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: srv.opts.MetricsNamespace,
+		Subsystem: srv.opts.MetricsSubsystem,
+		Name:      "grpc_server_in_flight_requests",
+		Help:      "Number of gRPC requests which are currently being handled",
+	}, []string{"grpc_method"})
+	srv.requestSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: srv.opts.MetricsNamespace,
+		Subsystem: srv.opts.MetricsSubsystem,
+		Name:      "grpc_server_request_size_bytes",
+		Help:      "Encoded size of the gRPC requests in bytes",
+		Buckets:   interceptor.MessageSizeBuckets,
+	}, []string{"grpc_method"})
+	srv.responseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: srv.opts.MetricsNamespace,
+		Subsystem: srv.opts.MetricsSubsystem,
+		Name:      "grpc_server_response_size_bytes",
+		Help:      "Encoded size of the gRPC responses in bytes",
+		Buckets:   interceptor.MessageSizeBuckets,
+	}, []string{"grpc_method"})
+	srv.inFlight = registerCollector(srv.inFlight).(*prometheus.GaugeVec)
+	srv.requestSize = registerCollector(srv.requestSize).(*prometheus.HistogramVec)
+	srv.responseSize = registerCollector(srv.responseSize).(*prometheus.HistogramVec)
+
+	// the default server metrics are registered by go-grpc-prometheus, prefixed metrics need their own instance
+	srv.metrics = grpcprometheus.DefaultServerMetrics
+	if srv.opts.MetricsNamespace != "" || srv.opts.MetricsSubsystem != "" {
+		srv.metrics = grpcprometheus.NewServerMetrics(func(opts *prometheus.CounterOpts) {
+			opts.Namespace = srv.opts.MetricsNamespace
+			opts.Subsystem = srv.opts.MetricsSubsystem
+		})
+		srv.metrics = registerCollector(srv.metrics).(*grpcprometheus.ServerMetrics)
+	}
+}
+
+// registerCollector registers the collector with the default registry. If another server of the process
+// already registered an equal collector, e.g. in tests which start several servers, the existing one is returned.
+func registerCollector(collector prometheus.Collector) prometheus.Collector {
+	if err := prometheus.Register(collector); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return collector
+}
+
 // setupGrpc will create a new, raw google gRPC server as well as the listener
 // If the listener cannot bind to the port, it's considered a fatal error on which
 // the application will be terminated.
 func (srv *GrpcServer) setupGrpc() {
 	var err error
 
-	grpcprometheus.EnableHandlingTimeHistogram()
-
-	srv.GoogleGrpc = grpc.NewServer(
-		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
-			grpcrecovery.UnaryServerInterceptor(),
-			interceptor.RequestId(),
-			grpcopentracing.UnaryServerInterceptor(),
-			grpcprometheus.UnaryServerInterceptor,
-		)),
-	)
-	srv.listener, err = net.Listen("tcp", fmt.Sprintf(":%v", srv.config.Port))
+	var histogramOpts []grpcprometheus.HistogramOption
+	if len(srv.opts.HandlingTimeBuckets) > 0 {
+		histogramOpts = append(histogramOpts, grpcprometheus.WithHistogramBuckets(srv.opts.HandlingTimeBuckets))
+	}
+	if srv.opts.MetricsNamespace != "" || srv.opts.MetricsSubsystem != "" {
+		histogramOpts = append(histogramOpts, func(opts *prometheus.HistogramOpts) {
+			opts.Namespace = srv.opts.MetricsNamespace
+			opts.Subsystem = srv.opts.MetricsSubsystem
+		})
+	}
+	srv.metrics.EnableHandlingTimeHistogram(histogramOpts...)
+
+	requestId := interceptor.RequestId()
+	streamRequestId := interceptor.StreamRequestId()
+	if len(srv.opts.TrustedPeers) > 0 {
+		requestId = interceptor.TrustedRequestId(srv.opts.TrustedPeers...)
+		streamRequestId = interceptor.TrustedStreamRequestId(srv.opts.TrustedPeers...)
+	}
+
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		interceptor.Recovery(srv.logger, srv.opts.RecoveryMode),
+		interceptor.InFlight(srv.inFlight),
+		interceptor.MessageSize(srv.requestSize, srv.responseSize),
+		requestId,
+		grpcopentracing.UnaryServerInterceptor(),
+		interceptor.Baggage(),
+		srv.metrics.UnaryServerInterceptor(),
+	}
+	if srv.opts.AccessLogging {
+		unaryInterceptors = append(unaryInterceptors, interceptor.Logger(srv.logger))
+	}
+	if srv.opts.PayloadLogging {
+		unaryInterceptors = append(unaryInterceptors,
+			interceptor.PayloadLogging(srv.logger, srv.opts.PayloadLogSize, srv.opts.RedactedFields...))
+	}
+	unaryInterceptors = append(unaryInterceptors, srv.opts.UnaryInterceptors...)
+
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		interceptor.StreamRecovery(srv.logger, srv.opts.RecoveryMode),
+		streamRequestId,
+		grpcopentracing.StreamServerInterceptor(),
+		srv.metrics.StreamServerInterceptor(),
+	}
+	streamInterceptors = append(streamInterceptors, srv.opts.StreamInterceptors...)
+
+	serverOptions := []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unaryInterceptors...)),
+		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(streamInterceptors...)),
+	}
+	if srv.opts.StatsHandler != nil {
+		serverOptions = append(serverOptions, grpc.StatsHandler(srv.opts.StatsHandler))
+	}
+	if srv.opts.InitialWindowSize > 0 {
+		serverOptions = append(serverOptions, grpc.InitialWindowSize(srv.opts.InitialWindowSize))
+	}
+	if srv.opts.InitialConnWindowSize > 0 {
+		serverOptions = append(serverOptions, grpc.InitialConnWindowSize(srv.opts.InitialConnWindowSize))
+	}
+	if srv.config.TLSCertFile != "" || srv.config.TLSKeyFile != "" {
+		creds, err := srv.credentials()
+		if err != nil {
+			srv.logger.Fatal("failed to load TLS credentials", zap.Error(err))
+		}
+		serverOptions = append(serverOptions, grpc.Creds(creds))
+	}
+	serverOptions = append(serverOptions, srv.keepaliveOptions()...)
+	serverOptions = append(serverOptions, srv.opts.ServerOptions...)
+
+	srv.GoogleGrpc = grpc.NewServer(serverOptions...)
+
+	// the server is not serving until ListenAndServe has been called
+	srv.health = health.NewServer()
+	srv.setServing(false)
+	healthpb.RegisterHealthServer(srv.GoogleGrpc, srv.health)
+
+	if srv.config.Reflection {
+		reflection.Register(srv.GoogleGrpc)
+		srv.logger.Warn("gRPC server reflection enabled, the schema of all services is exposed")
+	}
+	if srv.opts.Listener != nil {
+		srv.listener = srv.opts.Listener
+	} else {
+		srv.listener, err = net.Listen("tcp", fmt.Sprintf(":%v", srv.config.Port))
+		if err != nil {
+			srv.logger.Fatal("failed to listen on port", zap.Error(err))
+		}
+	}
+	if srv.config.MaxConnections > 0 {
+		srv.listener = netutil.LimitListener(srv.listener, srv.config.MaxConnections)
+		srv.logger.Info("gRPC connections limited", zap.Int("max connections", srv.config.MaxConnections))
+	}
+}
+
+// keepaliveOptions returns the keepalive server options of the GrpcConfig, none if the config leaves them unset
+func (srv *GrpcServer) keepaliveOptions() []grpc.ServerOption {
+	var options []grpc.ServerOption
+
+	params := keepalive.ServerParameters{
+		MaxConnectionIdle:     srv.config.MaxConnectionIdle,
+		MaxConnectionAge:      srv.config.MaxConnectionAge,
+		MaxConnectionAgeGrace: srv.config.MaxConnectionAgeGrace,
+		Time:                  srv.config.KeepaliveTime,
+		Timeout:               srv.config.KeepaliveTimeout,
+	}
+	if params != (keepalive.ServerParameters{}) {
+		options = append(options, grpc.KeepaliveParams(params))
+	}
+
+	if srv.config.KeepaliveMinTime > 0 || srv.config.KeepalivePermitWithoutStream {
+		options = append(options, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             srv.config.KeepaliveMinTime,
+			PermitWithoutStream: srv.config.KeepalivePermitWithoutStream,
+		}))
+	}
+	return options
+}
+
+// credentials builds the TLS transport credentials from the certificate files of the GrpcConfig
+func (srv *GrpcServer) credentials() (credentials.TransportCredentials, error) {
+	certificate, err := tls.LoadX509KeyPair(srv.config.TLSCertFile, srv.config.TLSKeyFile)
 	if err != nil {
-		srv.logger.Fatal("failed to listen on port", zap.Error(err))
+		return nil, fmt.Errorf("unable to load gRPC server certificate: %s", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
 	}
+	if srv.config.TLSClientCAFile != "" {
+		if err := requireClientCerts(config, srv.config.TLSClientCAFile); err != nil {
+			return nil, err
+		}
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// Addr returns the address the server is bound to. If the configured port is "0",
+// it contains the port which has been assigned by the operating system.
+func (srv *GrpcServer) Addr() net.Addr {
+	return srv.listener.Addr()
 }
 
 // ListenAndServe ties everything together and runs the gRPC server in a separate goroutine.
@@ -84,32 +303,33 @@ func (srv *GrpcServer) ListenAndServe(ctx context.Context, wg *sync.WaitGroup) {
 	go func() {
 		srv.logger.Info("gRPC server running", zap.String("port", srv.config.Port))
 		if err := srv.GoogleGrpc.Serve(srv.listener); err != nil {
-			srv.healthy = false
+			srv.setServing(false)
 			srv.logger.Fatal("gRPC server crashed", zap.Error(err))
 		}
 	}()
 
 	// server is healthy, tell everyone \(°ヮﾟ°)/
-	srv.healthy = true
+	srv.setServing(true)
 
 	<-ctx.Done()
 
 	// health checks fail from now on
-	srv.healthy = false
+	srv.setServing(false)
 
 	srv.logger.Info("gRPC server shutdown requested")
 	srv.shutdownGrpc()
 }
 
-// Health returns a http.HandlerFunc, it reports the gRPC server health: OK or UNHEALTHY
+// Health returns a http.HandlerFunc, it reports the gRPC server health: OK or UNHEALTHY.
+// It reports the overall status of the grpc.health.v1 service, so both endpoints always agree.
 func (srv *GrpcServer) Health() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// This endpoint must always return a 200.
 		// If it does not return a 200, the health endpoint itself is broken.
-		// If the service is healthy or not is defined through the atomic 'healthy' var
+		// If the service is healthy or not is defined through the overall status of the health service
 		w.WriteHeader(http.StatusOK)
 
-		if srv.healthy {
+		if srv.serving() {
 			_, _ = w.Write([]byte("OK"))
 		} else {
 			_, _ = w.Write([]byte("UNHEALTHY"))
@@ -117,19 +337,56 @@ func (srv *GrpcServer) Health() http.HandlerFunc {
 	}
 }
 
-// shutdownGrpc gracefully shuts down the gRPC server
+// SetServingStatus sets the status of a single service of the grpc.health.v1 service, e.g. while a
+// downstream dependency of that service is unavailable. The empty service name is the overall status
+// of the server which is managed by ListenAndServe. After Shutdown, all updates are ignored.
+func (srv *GrpcServer) SetServingStatus(service string, status healthpb.HealthCheckResponse_ServingStatus) {
+	srv.health.SetServingStatus(service, status)
+}
+
+// setServing sets the overall status of the server
+func (srv *GrpcServer) setServing(serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	srv.health.SetServingStatus("", status)
+}
+
+// serving reports whether the overall status of the server is SERVING
+func (srv *GrpcServer) serving() bool {
+	response, err := srv.health.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	return err == nil && response.Status == healthpb.HealthCheckResponse_SERVING
+}
+
+// shutdownGrpc gracefully shuts down the gRPC server within the configured grace period
 func (srv *GrpcServer) shutdownGrpc() {
+	ctx, cancel := context.WithTimeout(context.Background(), srv.config.GracePeriod)
+	defer cancel()
+	_ = srv.Shutdown(ctx)
+}
+
+// Shutdown gracefully stops the gRPC server: no new calls are accepted and running calls may finish.
+// If the context is done before all calls finished, the server is stopped forcibly and the context error
+// is returned. This allows a single shutdown deadline, e.g. of a lifecycle.Coordinator, to govern the
+// gRPC server instead of its own GracePeriod.
+func (srv *GrpcServer) Shutdown(ctx context.Context) error {
+	// all services report NOT_SERVING from now on
+	srv.health.Shutdown()
+
 	stopped := make(chan struct{})
 	go func() {
 		srv.GoogleGrpc.GracefulStop()
 		close(stopped)
 	}()
-	t := time.NewTicker(srv.config.GracePeriod)
+
 	select {
-	case <-t.C:
-		srv.logger.Warn("gRPC server graceful shutdown timed-out", zap.Duration("grace period", srv.config.GracePeriod))
+	case <-ctx.Done():
+		srv.logger.Warn("gRPC server graceful shutdown timed-out, stopping forcibly", zap.Error(ctx.Err()))
+		srv.GoogleGrpc.Stop()
+		return ctx.Err()
 	case <-stopped:
 		srv.logger.Info("gRPC server stopped gracefully")
-		t.Stop()
+		return nil
 	}
 }
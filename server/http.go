@@ -1,9 +1,13 @@
 package server
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,20 +17,55 @@ import (
 type HttpConfig struct {
 	Port        string        `mapstructure:"http-port"`
 	GracePeriod time.Duration `mapstructure:"http-grace-period"`
+	// DurationBuckets are the buckets of the request duration histogram in milliseconds, DefaultHttpDurationBuckets if empty
+	DurationBuckets []float64 `mapstructure:"http-duration-buckets"`
+	// TLSCertFile and TLSKeyFile enable HTTPS, the server speaks plaintext HTTP if they are empty
+	TLSCertFile string `mapstructure:"http-tls-cert-file"`
+	TLSKeyFile  string `mapstructure:"http-tls-key-file"`
+	// TLSClientCAFile enables mutual TLS, clients must present a certificate signed by one of its CAs
+	TLSClientCAFile string `mapstructure:"http-tls-client-ca-file"`
+	// ReadTimeout, WriteTimeout and IdleTimeout are passed to the http.Server, the defaults are used if they are zero.
+	// A negative value disables the timeout. Handlers which stream or long-poll need a WriteTimeout above their duration.
+	ReadTimeout  time.Duration `mapstructure:"http-read-timeout"`
+	WriteTimeout time.Duration `mapstructure:"http-write-timeout"`
+	IdleTimeout  time.Duration `mapstructure:"http-idle-timeout"`
 }
 
+// Default timeouts of the http.Server, see HttpConfig
+const (
+	DefaultHttpReadTimeout  = 15 * time.Second
+	DefaultHttpWriteTimeout = 15 * time.Second
+	DefaultHttpIdleTimeout  = 60 * time.Second
+)
+
+// DefaultHttpGracePeriod is used if the HttpConfig does not define a GracePeriod
+const DefaultHttpGracePeriod = 5 * time.Second
+
+// DefaultHttpDurationBuckets are the default buckets of the request duration histogram in milliseconds
+var DefaultHttpDurationBuckets = []float64{50, 100, 250, 500, 1000}
+
 type HttpServer struct {
 	logger  *zap.Logger
 	config  *HttpConfig
-	healthy bool
-	requestDuration prometheus.Histogram
+	opts    *HttpOptions
+	healthy int32 // accessed atomically, 1 while the server is serving
+	listenerMutex sync.Mutex
+	listener      net.Listener
+	requestDuration *prometheus.HistogramVec
+	middleware      []Middleware
 }
 
-func NewHttpServer(logger *zap.Logger, config *HttpConfig) *HttpServer {
+func NewHttpServer(logger *zap.Logger, config *HttpConfig, options ...HttpOption) *HttpServer {
+	args := &HttpOptions{}
+
+	for _, opt := range options {
+		opt(args)
+	}
+
 	srv := &HttpServer{
-		logger:  logger.Named("http"),
-		config:  config,
-		healthy: false,
+		logger: logger.Named("http"),
+		config: config,
+		opts:   args,
 	}
 
 	srv.registerMetrics()
@@ -34,7 +73,13 @@ func NewHttpServer(logger *zap.Logger, config *HttpConfig) *HttpServer {
 	return srv
 }
 
-// Health returns a http.HandlerFunc, it reports the gRPC server health: OK or UNHEALTHY
+// Use registers middleware which is wrapped around the handler of ListenAndServe.
+// The middleware registered first is the outermost, Use must be called before ListenAndServe.
+func (srv *HttpServer) Use(middleware ...Middleware) {
+	srv.middleware = append(srv.middleware, middleware...)
+}
+
+// Health returns a http.HandlerFunc, it reports the HTTP server health: OK or UNHEALTHY
 func (srv *HttpServer) Health() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// This endpoint must always return a 200.
@@ -42,7 +87,7 @@ func (srv *HttpServer) Health() http.HandlerFunc {
 		// If the service is healthy or not is defined through the atomic 'healthy' var
 		w.WriteHeader(http.StatusOK)
 
-		if srv.healthy {
+		if atomic.LoadInt32(&srv.healthy) == 1 {
 			_, _ = w.Write([]byte("OK"))
 		} else {
 			_, _ = w.Write([]byte("UNHEALTHY"))
@@ -51,43 +96,174 @@ func (srv *HttpServer) Health() http.HandlerFunc {
 }
 
 func (srv *HttpServer) registerMetrics()  {
-	srv.requestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
-		Name:    "http_request_duration_ms",
-		Help:    "Request duration in milliseconds",
-		Buckets: []float64{50, 100, 250, 500, 1000},
-	})
+	buckets := srv.config.DurationBuckets
+	if len(buckets) == 0 {
+		buckets = DefaultHttpDurationBuckets
+	}
+	srv.requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: srv.opts.MetricsNamespace,
+		Subsystem: srv.opts.MetricsSubsystem,
+		Name:      "http_request_duration_ms",
+		Help:      "Request duration in milliseconds",
+		Buckets:   buckets,
+	}, []string{"method", "code"})
 	prometheus.MustRegister(srv.requestDuration)
 }
 
+// instrument records the duration of every request in the request duration histogram
+func (srv *HttpServer) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		srv.requestDuration.
+			WithLabelValues(r.Method, strconv.Itoa(recorder.status)).
+			Observe(float64(time.Since(start)) / float64(time.Millisecond))
+	})
+}
+
 func (srv *HttpServer) ListenAndServe(ctx context.Context, wg *sync.WaitGroup, handler http.Handler) {
 	defer wg.Done()
 
-	if srv.config.Port == "" {
+	if srv.config.Port == "" && srv.opts.Listener == nil && (srv.opts.Server == nil || srv.opts.Server.Addr == "") {
 		srv.logger.Error("missing http port, server will not be started")
 		return
 	}
 
-	httpServer := &http.Server{Addr: fmt.Sprintf("0.0.0.0:%s", srv.config.Port), Handler: handler}
+	httpServer := srv.opts.Server
+	if httpServer == nil {
+		httpServer = &http.Server{}
+	}
+	if httpServer.Addr == "" {
+		httpServer.Addr = fmt.Sprintf("0.0.0.0:%s", srv.config.Port)
+	}
+	if httpServer.ReadTimeout == 0 {
+		httpServer.ReadTimeout = timeout(srv.config.ReadTimeout, DefaultHttpReadTimeout)
+	}
+	if httpServer.WriteTimeout == 0 {
+		httpServer.WriteTimeout = timeout(srv.config.WriteTimeout, DefaultHttpWriteTimeout)
+	}
+	if httpServer.IdleTimeout == 0 {
+		httpServer.IdleTimeout = timeout(srv.config.IdleTimeout, DefaultHttpIdleTimeout)
+	}
+	if httpServer.Handler == nil {
+		httpServer.Handler = handler
+	}
+	for i := len(srv.middleware) - 1; i >= 0; i-- {
+		httpServer.Handler = srv.middleware[i](httpServer.Handler)
+	}
+	httpServer.Handler = srv.instrument(httpServer.Handler)
+
+	// request contexts are derived from the base context, handlers observe the start of the shutdown
+	// through ShutdownStarted and their context is cancelled once the grace period has elapsed
+	shutdownStarted := make(chan struct{})
+	baseCtx, cancelBase := context.WithCancel(context.WithValue(context.Background(), shutdownKey{}, shutdownStarted))
+	defer cancelBase()
+	if httpServer.BaseContext == nil {
+		httpServer.BaseContext = func(net.Listener) context.Context {
+			return baseCtx
+		}
+	}
 
 	// serve
 	go func() {
-		srv.logger.Info("http server started", zap.String("port", srv.config.Port))
-		srv.healthy = true
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		srv.logger.Info("http server started", zap.String("port", srv.config.Port), zap.Bool("tls", srv.config.TLSCertFile != ""))
+		atomic.StoreInt32(&srv.healthy, 1)
+		if err := srv.serve(httpServer); err != nil && err != http.ErrServerClosed {
 			srv.logger.Fatal("http server crashed", zap.Error(err))
 		}
 	}()
 
 	<-ctx.Done()
 	srv.logger.Info("http server shutdown requested")
-	srv.healthy = false
+	atomic.StoreInt32(&srv.healthy, 0)
+	close(shutdownStarted)
 
-	gracePeriod := 5 * time.Second
+	// respond with 'Connection: close' so that idle keep-alive connections drain before the grace period ends
+	httpServer.SetKeepAlivesEnabled(false)
+
+	gracePeriod := srv.config.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultHttpGracePeriod
+	}
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), gracePeriod)
 	defer cancel()
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
-		srv.logger.Warn("gRPC server graceful shutdown timed-out", zap.Error(err), zap.Duration("grace period", gracePeriod))
+		cancelBase()
+		srv.logger.Warn("http server graceful shutdown timed-out", zap.Error(err), zap.Duration("grace period", gracePeriod))
 	} else {
 		srv.logger.Info("http server stopped gracefully")
 	}
 }
+
+// timeout returns the configured timeout, the default if it is zero and 0 (no timeout) if it is negative
+func timeout(configured, fallback time.Duration) time.Duration {
+	switch {
+	case configured < 0:
+		return 0
+	case configured == 0:
+		return fallback
+	}
+	return configured
+}
+
+type shutdownKey struct{}
+
+// ShutdownStarted returns a channel which is closed as soon as the HttpServer begins to shut down.
+// Long-running handlers can use it to wind down before their request context is cancelled
+// at the end of the grace period. Outside of an HttpServer request the channel is nil.
+func ShutdownStarted(ctx context.Context) <-chan struct{} {
+	started, _ := ctx.Value(shutdownKey{}).(chan struct{})
+	return started
+}
+
+// Addr returns the address the server is bound to, or nil if ListenAndServe did not bind yet.
+// If the configured port is "0", it contains the port which has been assigned by the operating system.
+func (srv *HttpServer) Addr() net.Addr {
+	srv.listenerMutex.Lock()
+	defer srv.listenerMutex.Unlock()
+	if srv.listener == nil {
+		return nil
+	}
+	return srv.listener.Addr()
+}
+
+// serve uses the external listener if one is configured, otherwise the server listens on its address
+func (srv *HttpServer) serve(httpServer *http.Server) error {
+	listener := srv.opts.Listener
+	if listener == nil {
+		var err error
+		if listener, err = net.Listen("tcp", httpServer.Addr); err != nil {
+			return err
+		}
+	}
+	srv.listenerMutex.Lock()
+	srv.listener = listener
+	srv.listenerMutex.Unlock()
+
+	if srv.config.TLSCertFile == "" && srv.config.TLSKeyFile == "" {
+		return httpServer.Serve(listener)
+	}
+	tlsConfig, err := srv.tlsConfig(httpServer.TLSConfig)
+	if err != nil {
+		return err
+	}
+	httpServer.TLSConfig = tlsConfig
+	return httpServer.ServeTLS(listener, srv.config.TLSCertFile, srv.config.TLSKeyFile)
+}
+
+// tlsConfig extends the TLS config of the http.Server, if any, with the client CAs of the HttpConfig.
+// The certificate itself is loaded by ServeTLS.
+func (srv *HttpServer) tlsConfig(base *tls.Config) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		config = base.Clone()
+	}
+	if srv.config.TLSClientCAFile == "" {
+		return config, nil
+	}
+	if err := requireClientCerts(config, srv.config.TLSClientCAFile); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
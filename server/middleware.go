@@ -0,0 +1,258 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/lukasjarosch/enki/logging"
+	"github.com/lukasjarosch/enki/recovery"
+)
+
+// RequestIDHeader is the header from which the request-id of HTTP requests is read
+const RequestIDHeader = "X-Request-Id"
+
+// Middleware wraps a http.Handler, see HttpServer.Use
+type Middleware func(http.Handler) http.Handler
+
+// DefaultMiddleware returns the built-in middleware in the recommended order: RequestID, AccessLog and Recovery.
+// Recovery is the innermost, so that the access-log contains the '500 Internal Server Error' of a panic.
+//
+//	srv.Use(server.DefaultMiddleware(logger)...)
+func DefaultMiddleware(logger *zap.Logger) []Middleware {
+	return []Middleware{
+		RequestID(),
+		AccessLog(logger),
+		Recovery(logger),
+	}
+}
+
+// RequestID returns a middleware which ensures that every request has a request-id in the RequestIDHeader.
+// An incoming request-id is honored, otherwise a new one is generated. The request-id is also sent in the response.
+func RequestID() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(RequestIDHeader)
+			if requestID == "" {
+				requestID = uuid.New().String()
+				r.Header.Set(RequestIDHeader, requestID)
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AccessLog returns a middleware which logs every request after it has been handled,
+// using the access-log schema of the logging package.
+func AccessLog(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			logger.Info("http request handled",
+				zap.String(logging.FieldMethod, r.Method),
+				zap.String(logging.FieldPath, r.URL.Path),
+				zap.Int(logging.FieldStatus, recorder.status),
+				logging.DurationMs(time.Since(start)),
+				zap.String(logging.FieldRequestID, r.Header.Get(RequestIDHeader)),
+				zap.String(logging.FieldPeer, r.RemoteAddr))
+		})
+	}
+}
+
+// Recovery returns a middleware which recovers from panics in the handler. The panic is logged using
+// recovery.Log together with the method, path and request-id and a '500 Internal Server Error' is returned.
+// http.ErrAbortHandler is re-raised, it is used to abort a response on purpose.
+func Recovery(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				recovery.Log(logger, p, recovery.TransportHTTP,
+					zap.String(logging.FieldMethod, r.Method),
+					zap.String(logging.FieldPath, r.URL.Path),
+					zap.String(logging.FieldRequestID, r.Header.Get(RequestIDHeader)))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DefaultMaxBodyBytes is a sensible default for MaxBytes if no endpoint expects large uploads
+const DefaultMaxBodyBytes int64 = 1 << 20
+
+// ErrBodyTooLarge is returned by the request body and the response writer once MaxBytes rejected the request
+var ErrBodyTooLarge = errors.New("http: request body too large")
+
+type bodyKey struct{}
+
+// MaxBytes returns a middleware which limits the request body to the given amount of bytes.
+// Requests announcing a larger Content-Length are rejected with '413 Request Entity Too Large'
+// as soon as the handler reads the body or starts the response, or once it returns. The body then fails
+// with ErrBodyTooLarge and the response of the handler is discarded. Bodies without a Content-Length
+// are cut off at the limit and the handler receives an error on read, http.Server then closes the
+// connection after the response.
+//
+// MaxBytes can be nested to override a global limit for single routes, the innermost limit wins:
+//
+//	mux.Handle("/upload", server.MaxBytes(50<<20)(uploadHandler))
+//	httpServer.ListenAndServe(ctx, wg, server.MaxBytes(server.DefaultMaxBodyBytes)(mux))
+func MaxBytes(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// an outer MaxBytes already limits the body, override its limit
+			if body, ok := r.Context().Value(bodyKey{}).(*limitedBody); ok {
+				body.setLimit(limit)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body := &limitedBody{
+				w:             w,
+				body:          r.Body,
+				contentLength: r.ContentLength,
+				limit:         limit,
+			}
+			r = r.WithContext(context.WithValue(r.Context(), bodyKey{}, body))
+			r.Body = body
+			next.ServeHTTP(&limitedWriter{ResponseWriter: w, body: body}, r)
+
+			// the handler neither read the body nor responded
+			body.resolve()
+		})
+	}
+}
+
+// limitedBody applies the limit of the innermost MaxBytes. The limit is resolved on the first read or
+// response write, when all nested MaxBytes have been passed.
+type limitedBody struct {
+	w             http.ResponseWriter
+	body          io.ReadCloser
+	contentLength int64
+	limit         int64
+	resolved      bool
+	rejected      bool
+	reader        io.ReadCloser
+}
+
+func (b *limitedBody) setLimit(limit int64) {
+	if !b.resolved {
+		b.limit = limit
+	}
+}
+
+// resolve rejects the request with '413 Request Entity Too Large' if the Content-Length exceeds the limit,
+// it reports whether the request is accepted
+func (b *limitedBody) resolve() bool {
+	if !b.resolved {
+		b.resolved = true
+		if b.contentLength > b.limit {
+			b.rejected = true
+			http.Error(b.w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		} else {
+			b.reader = http.MaxBytesReader(b.w, b.body, b.limit)
+		}
+	}
+	return !b.rejected
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if !b.resolve() {
+		return 0, ErrBodyTooLarge
+	}
+	return b.reader.Read(p)
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// limitedWriter resolves the body limit before the handler responds and discards the response of rejected requests
+type limitedWriter struct {
+	http.ResponseWriter
+	body *limitedBody
+}
+
+func (w *limitedWriter) WriteHeader(status int) {
+	if w.body.resolve() {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *limitedWriter) Write(b []byte) (int, error) {
+	if !w.body.resolve() {
+		return 0, ErrBodyTooLarge
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *limitedWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && w.body.resolve() {
+		flusher.Flush()
+	}
+}
+
+func (w *limitedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not implement http.Hijacker")
+	}
+	return hijacker.Hijack()
+}
+
+// statusRecorder remembers the status code written by the handler. Flush and Hijack are passed
+// through, so that streaming and websocket handlers keep working behind the middleware.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not implement http.Hijacker")
+	}
+	return hijacker.Hijack()
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func readBody(w http.ResponseWriter, r *http.Request) {
+	if _, err := ioutil.ReadAll(r.Body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestMaxBytes(t *testing.T) {
+	ignoreBody := func(w http.ResponseWriter, r *http.Request) {}
+
+	tests := []struct {
+		name    string
+		size    int
+		handler http.HandlerFunc
+		status  int
+	}{
+		{name: "within limit", size: 1024, handler: readBody, status: http.StatusOK},
+		{name: "exceeds limit", size: 4096, handler: readBody, status: http.StatusRequestEntityTooLarge},
+		{name: "exceeds limit, body not read", size: 4096, handler: ignoreBody, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := MaxBytes(2048)(test.handler)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(make([]byte, test.size)))
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.status {
+				t.Errorf("expected status %d, got %d", test.status, rec.Code)
+			}
+		})
+	}
+}
+
+func TestMaxBytesNested(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/upload", MaxBytes(8192)(http.HandlerFunc(readBody)))
+	mux.HandleFunc("/other", readBody)
+	handler := MaxBytes(2048)(mux)
+
+	tests := []struct {
+		path   string
+		size   int
+		status int
+	}{
+		{path: "/upload", size: 4096, status: http.StatusOK},
+		{path: "/upload", size: 16384, status: http.StatusRequestEntityTooLarge},
+		{path: "/other", size: 4096, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, test.path, bytes.NewReader(make([]byte, test.size)))
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.status {
+			t.Errorf("%s with %d bytes: expected status %d, got %d", test.path, test.size, test.status, rec.Code)
+		}
+	}
+}
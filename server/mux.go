@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/soheilhy/cmux"
+	"go.uber.org/zap"
+)
+
+// Mux serves gRPC and HTTP on a single port. gRPC requests are detected by their
+// HTTP/2 content-type, every other connection is passed to the HTTP listener.
+//
+//	mux, err := server.NewMux(logger, "8080")
+//	grpcServer := server.NewGrpcServer(logger, grpcConfig, server.WithListener(mux.GrpcListener()))
+//	httpServer := server.NewHttpServer(logger, httpConfig, server.WithHttpListener(mux.HttpListener()))
+type Mux struct {
+	logger   *zap.Logger
+	port     string
+	listener net.Listener
+	mux      cmux.CMux
+	grpc     net.Listener
+	http     net.Listener
+}
+
+// NewMux listens on the port and prepares the gRPC and HTTP listeners
+func NewMux(logger *zap.Logger, port string) (*Mux, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%v", port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on port %s: %s", port, err)
+	}
+
+	mux := cmux.New(listener)
+	return &Mux{
+		logger:   logger.Named("mux"),
+		port:     port,
+		listener: listener,
+		mux:      mux,
+		grpc:     mux.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc")),
+		http:     mux.Match(cmux.Any()),
+	}, nil
+}
+
+// GrpcListener returns the listener which accepts the gRPC connections
+func (m *Mux) GrpcListener() net.Listener {
+	return m.grpc
+}
+
+// HttpListener returns the listener which accepts all other connections
+func (m *Mux) HttpListener() net.Listener {
+	return m.http
+}
+
+// Addr returns the address the mux is bound to, including the assigned port if port "0" was requested
+func (m *Mux) Addr() net.Addr {
+	return m.listener.Addr()
+}
+
+// ListenAndServe starts multiplexing in a separate goroutine and blocks until the context is cancelled.
+// The servers using the listeners should be shut down before the context is cancelled.
+func (m *Mux) ListenAndServe(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	go func() {
+		m.logger.Info("mux running", zap.String("port", m.port))
+		if err := m.mux.Serve(); err != nil && ctx.Err() == nil {
+			m.logger.Error("mux stopped", zap.Error(err))
+		}
+	}()
+
+	<-ctx.Done()
+	if err := m.listener.Close(); err != nil {
+		m.logger.Warn("failed to close mux listener", zap.Error(err))
+	}
+	m.logger.Info("mux stopped")
+}
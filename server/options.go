@@ -0,0 +1,179 @@
+package server
+
+import (
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+
+	"github.com/lukasjarosch/enki/interceptor"
+)
+
+// GrpcOptions holds the optional settings of the GrpcServer
+type GrpcOptions struct {
+	RecoveryMode   interceptor.RecoveryMode
+	PayloadLogging bool
+	AccessLogging  bool
+	PayloadLogSize int
+	RedactedFields []string
+	// HandlingTimeBuckets are the buckets (in seconds) of the gRPC handling time histogram
+	HandlingTimeBuckets []float64
+	// TrustedPeers are the networks from which incoming request-ids are honored, if empty all peers are trusted
+	TrustedPeers []*net.IPNet
+	StatsHandler stats.Handler
+	// Listener is used instead of listening on the configured port
+	Listener net.Listener
+	// MetricsNamespace and MetricsSubsystem prefix the names of all metrics of the server
+	MetricsNamespace string
+	MetricsSubsystem string
+	// InitialWindowSize and InitialConnWindowSize are the HTTP/2 flow-control windows, 0 keeps the gRPC defaults
+	InitialWindowSize     int32
+	InitialConnWindowSize int32
+	// UnaryInterceptors are appended to the built-in interceptor chain
+	UnaryInterceptors []grpc.UnaryServerInterceptor
+	// StreamInterceptors are appended to the built-in stream interceptor chain
+	StreamInterceptors []grpc.StreamServerInterceptor
+	// ServerOptions are passed to grpc.NewServer after the options of the GrpcServer
+	ServerOptions []grpc.ServerOption
+}
+
+type GrpcOption func(*GrpcOptions)
+
+// WithRecoveryMode configures how the gRPC server behaves after it recovered from a panic in a handler.
+// By default the panic is converted into a codes.Internal error.
+func WithRecoveryMode(mode interceptor.RecoveryMode) GrpcOption {
+	return func(options *GrpcOptions) {
+		options.RecoveryMode = mode
+	}
+}
+
+// WithPayloadLogging adds the interceptor.PayloadLogging interceptor to the chain.
+// Payloads are only logged if the logger of the server has debug level enabled.
+func WithPayloadLogging(maxSize int, redactedFields ...string) GrpcOption {
+	return func(options *GrpcOptions) {
+		options.PayloadLogging = true
+		options.PayloadLogSize = maxSize
+		options.RedactedFields = redactedFields
+	}
+}
+
+// WithAccessLogging adds the interceptor.Logger interceptor to the chain, every call is logged with
+// its method, duration, status code and request-id.
+func WithAccessLogging() GrpcOption {
+	return func(options *GrpcOptions) {
+		options.AccessLogging = true
+	}
+}
+
+// WithHandlingTimeBuckets sets the buckets (in seconds) of the grpc_server_handling_seconds histogram.
+// By default, the prometheus default buckets are used.
+func WithHandlingTimeBuckets(buckets ...float64) GrpcOption {
+	return func(options *GrpcOptions) {
+		options.HandlingTimeBuckets = buckets
+	}
+}
+
+// WithTrustedPeers restricts the peers from which incoming request-ids are honored.
+// Requests from any other peer get a new request-id. See interceptor.ParseCIDRs.
+func WithTrustedPeers(networks ...*net.IPNet) GrpcOption {
+	return func(options *GrpcOptions) {
+		options.TrustedPeers = networks
+	}
+}
+
+// WithStatsHandler registers a gRPC stats.Handler (e.g. OpenTelemetry) with the server
+func WithStatsHandler(handler stats.Handler) GrpcOption {
+	return func(options *GrpcOptions) {
+		options.StatsHandler = handler
+	}
+}
+
+// WithListener passes an external listener (e.g. from a Mux) which is served instead of listening on the configured port
+func WithListener(listener net.Listener) GrpcOption {
+	return func(options *GrpcOptions) {
+		options.Listener = listener
+	}
+}
+
+// WithMetricsNamespace prefixes the names of all metrics registered by the gRPC server,
+// e.g. 'grpc_server_handled_total' becomes 'namespace_subsystem_grpc_server_handled_total'.
+// Empty values keep the bare metric names.
+func WithMetricsNamespace(namespace, subsystem string) GrpcOption {
+	return func(options *GrpcOptions) {
+		options.MetricsNamespace = namespace
+		options.MetricsSubsystem = subsystem
+	}
+}
+
+// WithInitialWindowSize sets the HTTP/2 flow-control window per stream and per connection.
+// Larger windows increase the throughput on high-latency, high-bandwidth links, gRPC ignores values below 64KiB.
+// A value of 0 keeps the respective gRPC default.
+func WithInitialWindowSize(stream, conn int32) GrpcOption {
+	return func(options *GrpcOptions) {
+		options.InitialWindowSize = stream
+		options.InitialConnWindowSize = conn
+	}
+}
+
+// WithUnaryInterceptors appends interceptors to the built-in chain, e.g. authentication or rate limiting.
+// They run in the given order after the built-in interceptors, so the request-id, tracing span and
+// metrics are already available. The option can be passed multiple times.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) GrpcOption {
+	return func(options *GrpcOptions) {
+		options.UnaryInterceptors = append(options.UnaryInterceptors, interceptors...)
+	}
+}
+
+// WithStreamInterceptors appends interceptors to the built-in stream interceptor chain,
+// they run in the given order after the built-in interceptors. The option can be passed multiple times.
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) GrpcOption {
+	return func(options *GrpcOptions) {
+		options.StreamInterceptors = append(options.StreamInterceptors, interceptors...)
+	}
+}
+
+// WithServerOptions passes additional options to grpc.NewServer, e.g. grpc.MaxRecvMsgSize.
+// grpc.UnaryInterceptor and grpc.StreamInterceptor must not be passed, the GrpcServer sets them already;
+// use WithUnaryInterceptors and WithStreamInterceptors instead.
+func WithServerOptions(serverOptions ...grpc.ServerOption) GrpcOption {
+	return func(options *GrpcOptions) {
+		options.ServerOptions = append(options.ServerOptions, serverOptions...)
+	}
+}
+
+// HttpOptions holds the optional settings of the HttpServer
+type HttpOptions struct {
+	Server *http.Server
+	// Listener is used instead of listening on the configured port
+	Listener net.Listener
+	// MetricsNamespace and MetricsSubsystem prefix the names of all metrics of the server
+	MetricsNamespace string
+	MetricsSubsystem string
+}
+
+type HttpOption func(*HttpOptions)
+
+// WithHttpServer passes a pre-configured http.Server which is used instead of creating one.
+// Addr and Handler are filled in by the HttpServer if they are empty.
+func WithHttpServer(server *http.Server) HttpOption {
+	return func(options *HttpOptions) {
+		options.Server = server
+	}
+}
+
+// WithHttpListener passes an external listener (e.g. from a Mux) which is served instead of listening on the configured port
+func WithHttpListener(listener net.Listener) HttpOption {
+	return func(options *HttpOptions) {
+		options.Listener = listener
+	}
+}
+
+// WithHttpMetricsNamespace prefixes the names of all metrics registered by the HTTP server.
+// Empty values keep the bare metric names.
+func WithHttpMetricsNamespace(namespace, subsystem string) HttpOption {
+	return func(options *HttpOptions) {
+		options.MetricsNamespace = namespace
+		options.MetricsSubsystem = subsystem
+	}
+}
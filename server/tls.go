@@ -0,0 +1,23 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// requireClientCerts makes the TLS config verify client certificates against the CAs in the PEM file
+func requireClientCerts(config *tls.Config, caFile string) error {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("unable to read client CA file: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in client CA file %s", caFile)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return nil
+}
@@ -0,0 +1,49 @@
+package signals
+
+import (
+	"time"
+)
+
+// DefaultTimeoutExitCode is the exit code if the shutdown exceeded the ShutdownTimeout
+const DefaultTimeoutExitCode = 124
+
+type Options struct {
+	ExitCode        int
+	BeforeExit      func()
+	ShutdownTimeout time.Duration
+	TimeoutExitCode int
+}
+
+type Option func(*Options)
+
+// ExitCode sets the code the application exits with on the second signal, it defaults to 1.
+func ExitCode(code int) Option {
+	return func(options *Options) {
+		options.ExitCode = code
+	}
+}
+
+// BeforeExit sets a hook which is executed after the second signal, right before the application exits.
+// It can be used to flush telemetry, but must return quickly.
+func BeforeExit(hook func()) Option {
+	return func(options *Options) {
+		options.BeforeExit = hook
+	}
+}
+
+// ShutdownTimeout sets a hard deadline after the first signal. If the application is still running
+// when it elapses, the stacks of all goroutines are written to stderr and the application exits with
+// the TimeoutExitCode. This bounds a hung shutdown and shows what was stuck. 0 disables the watchdog.
+func ShutdownTimeout(timeout time.Duration) Option {
+	return func(options *Options) {
+		options.ShutdownTimeout = timeout
+	}
+}
+
+// TimeoutExitCode sets the code the application exits with if the ShutdownTimeout elapsed,
+// it defaults to DefaultTimeoutExitCode.
+func TimeoutExitCode(code int) Option {
+	return func(options *Options) {
+		options.TimeoutExitCode = code
+	}
+}
@@ -2,13 +2,18 @@ package signals
 
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
+	"runtime"
+	"sync"
 	"syscall"
+	"time"
 )
 
 var onlyOneSignalHandler = make(chan struct{})
 var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+var reloadSignals = []os.Signal{syscall.SIGHUP}
 
 // SetupSignalHandler registers a SIGTERM and SIGINT handler.
 // A stop channel is returned, which is closed when one of these signals are caught.
@@ -16,15 +21,96 @@ var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
 func SetupSignalHandler() (stopCh <-chan struct{}) {
 	close(onlyOneSignalHandler)
 
+	stop, _ := NewSignalHandler()
+	return stop
+}
+
+// SetupSignalHandlerWithReload behaves like SetupSignalHandler, but additionally registers a SIGHUP handler.
+// Every caught SIGHUP invokes the reload callback without closing the stop channel.
+// Reload signals do not count towards the second signal which terminates the application.
+// The callbacks are executed sequentially, a SIGHUP caught while reload is still running is handled afterwards.
+func SetupSignalHandlerWithReload(reload func()) (stopCh <-chan struct{}) {
+	stop := SetupSignalHandler()
+
+	r := make(chan os.Signal, 1)
+	signal.Notify(r, reloadSignals...)
+	go func() {
+		for range r {
+			reload()
+		}
+	}()
+
+	return stop
+}
+
+// NewSignalHandler registers a SIGTERM and SIGINT handler, just like SetupSignalHandler.
+// The behaviour on the second signal can be customized using the options.
+// The returned cancel func unregisters the handler and stops its goroutine, the stop channel is not closed by it.
+// Unlike SetupSignalHandler, it may be called multiple times (e.g. in tests).
+func NewSignalHandler(options ...Option) (stopCh <-chan struct{}, cancel func()) {
+	args := &Options{
+		ExitCode:        1,
+		TimeoutExitCode: DefaultTimeoutExitCode,
+	}
+
+	for _, opt := range options {
+		opt(args)
+	}
+
 	stop := make(chan struct{})
+	done := make(chan struct{})
 	c := make(chan os.Signal, 2)
 	signal.Notify(c, shutdownSignals...)
 	go func() {
-		<-c
-		close(stop)
-		<-c
-		os.Exit(1) // second signal: terminate immediately
+		select {
+		case <-c:
+			close(stop)
+		case <-done:
+			return
+		}
+
+		var timeout <-chan time.Time
+		if args.ShutdownTimeout > 0 {
+			timer := time.NewTimer(args.ShutdownTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		exitCode := args.ExitCode
+		select {
+		case <-c:
+		case <-timeout:
+			_, _ = fmt.Fprintf(os.Stderr, "shutdown did not complete within %s, running goroutines:\n\n%s\n",
+				args.ShutdownTimeout, goroutineStacks())
+			exitCode = args.TimeoutExitCode
+		case <-done:
+			return
+		}
+		if args.BeforeExit != nil {
+			args.BeforeExit()
+		}
+		os.Exit(exitCode) // second signal or shutdown timeout: terminate immediately
 	}()
 
-	return stop
-}
\ No newline at end of file
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+
+	return stop, cancel
+}
+
+// goroutineStacks returns the stacks of all goroutines
+func goroutineStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,81 @@
+package trace
+
+import (
+	"context"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// BaggagePrefix is prepended to the baggage keys when they are propagated through headers or metadata
+const BaggagePrefix = "ot-baggage-"
+
+type baggageKey struct{}
+
+// SetBaggageItem stores the baggage item in the context and on the active span.
+// Not every tracer propagates baggage (the zipkin bridge drops it), so the context carries the items
+// across gRPC and AMQP hops independently of the tracer. Keys are case-insensitive.
+func SetBaggageItem(ctx context.Context, key, value string) context.Context {
+	key = strings.ToLower(key)
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		span.SetBaggageItem(key, value)
+	}
+
+	current, _ := ctx.Value(baggageKey{}).(map[string]string)
+	items := make(map[string]string, len(current)+1)
+	for k, v := range current {
+		items[k] = v
+	}
+	items[key] = value
+	return context.WithValue(ctx, baggageKey{}, items)
+}
+
+// BaggageItem returns the baggage item from the context or the active span, an empty string if it is not set
+func BaggageItem(ctx context.Context, key string) string {
+	key = strings.ToLower(key)
+	if items, ok := ctx.Value(baggageKey{}).(map[string]string); ok {
+		if value, ok := items[key]; ok {
+			return value
+		}
+	}
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		return span.BaggageItem(key)
+	}
+	return ""
+}
+
+// BaggageItems returns all baggage items of the active span and the context
+func BaggageItems(ctx context.Context) map[string]string {
+	items := make(map[string]string)
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		span.Context().ForeachBaggageItem(func(k, v string) bool {
+			items[strings.ToLower(k)] = v
+			return true
+		})
+	}
+	if current, ok := ctx.Value(baggageKey{}).(map[string]string); ok {
+		for k, v := range current {
+			items[k] = v
+		}
+	}
+	return items
+}
+
+// InjectBaggage writes all baggage items of the context into the carrier, prefixed with BaggagePrefix
+func InjectBaggage(ctx context.Context, carrier opentracing.TextMapWriter) {
+	for key, value := range BaggageItems(ctx) {
+		carrier.Set(BaggagePrefix+key, value)
+	}
+}
+
+// ExtractBaggage reads all baggage items from the carrier into the context
+func ExtractBaggage(ctx context.Context, carrier opentracing.TextMapReader) context.Context {
+	_ = carrier.ForeachKey(func(key, value string) error {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, BaggagePrefix) {
+			ctx = SetBaggageItem(ctx, strings.TrimPrefix(key, BaggagePrefix), value)
+		}
+		return nil
+	})
+	return ctx
+}
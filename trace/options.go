@@ -0,0 +1,44 @@
+package trace
+
+import (
+	"time"
+)
+
+// Options configure the batching of the zipkin reporter. Zero values keep the reporter defaults.
+type Options struct {
+	BatchSize     int
+	BatchInterval time.Duration
+	Timeout       time.Duration
+	MaxBacklog    int
+}
+
+type Option func(*Options)
+
+// BatchSize sets the maximum amount of spans sent in a single request
+func BatchSize(n int) Option {
+	return func(options *Options) {
+		options.BatchSize = n
+	}
+}
+
+// BatchInterval sets the maximum time a span is buffered before the batch is sent
+func BatchInterval(interval time.Duration) Option {
+	return func(options *Options) {
+		options.BatchInterval = interval
+	}
+}
+
+// Timeout sets the HTTP timeout of requests to the collector.
+// A slow collector then cannot back up the queue of the reporter.
+func Timeout(timeout time.Duration) Option {
+	return func(options *Options) {
+		options.Timeout = timeout
+	}
+}
+
+// MaxBacklog sets the maximum amount of buffered spans, older spans are dropped if it is exceeded
+func MaxBacklog(n int) Option {
+	return func(options *Options) {
+		options.MaxBacklog = n
+	}
+}
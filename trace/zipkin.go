@@ -9,8 +9,14 @@ import (
 )
 
 
-func NewZipkinTracer(reporterUrl string, hostname string, servicePort uint16) error {
-	reporter := reporterhttp.NewReporter(reporterUrl)
+func NewZipkinTracer(reporterUrl string, hostname string, servicePort uint16, options ...Option) error {
+	args := &Options{}
+
+	for _, opt := range options {
+		opt(args)
+	}
+
+	reporter := reporterhttp.NewReporter(reporterUrl, reporterOptions(args)...)
 	var localEndpoint = &model.Endpoint{ServiceName: hostname, Port: servicePort}
 	sampler, err := zipkin.NewCountingSampler(1)
 	if err != nil {
@@ -28,3 +34,21 @@ func NewZipkinTracer(reporterUrl string, hostname string, servicePort uint16) er
 	return nil
 }
 
+
+// reporterOptions converts the options into zipkin reporter options, zero values are skipped
+func reporterOptions(options *Options) []reporterhttp.ReporterOption {
+	var opts []reporterhttp.ReporterOption
+	if options.BatchSize > 0 {
+		opts = append(opts, reporterhttp.BatchSize(options.BatchSize))
+	}
+	if options.BatchInterval > 0 {
+		opts = append(opts, reporterhttp.BatchInterval(options.BatchInterval))
+	}
+	if options.Timeout > 0 {
+		opts = append(opts, reporterhttp.Timeout(options.Timeout))
+	}
+	if options.MaxBacklog > 0 {
+		opts = append(opts, reporterhttp.MaxBacklog(options.MaxBacklog))
+	}
+	return opts
+}